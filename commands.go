@@ -0,0 +1,680 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/config"
+	"github.com/davidaniva/immich-importer/internal/importer"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string)
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "import", args: "[flags]", summary: "Download and import Takeout files without the interactive menu", run: runImportCommand},
+		{name: "status", args: "", summary: "Show the current import job and its progress", run: runStatusCommand},
+		{name: "list", args: "", summary: "List Google Takeout files in your Drive", run: runListCommand},
+		{name: "retry", args: "", summary: "Resume the current job after an error or interruption", run: runRetryCommand},
+		{name: "jobs", args: "list | show <job-id> | resume [flags] <job-id>", summary: "List, inspect and resume import jobs", run: runJobsCommand},
+		{name: "reset", args: "[--yes] [job-id]", summary: "Forget the current import job, or the given one", run: runResetCommand},
+		{name: "rollback", args: "[--force] [--yes] <job-id>", summary: "Delete everything an import job uploaded", run: runRollbackCommand},
+		{name: "cleanup", args: "[--yes]", summary: "Delete downloaded Takeout files", run: runCleanupCommand},
+		{name: "config", args: "rekey", summary: "Manage the stored configuration", run: runConfigCommand},
+		{name: "help", args: "[command]", summary: "Show help for a command", run: runHelpCommand},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  immich-importer [--server URL --token TOKEN]   Run the interactive importer")
+	fmt.Println("  immich-importer [--server URL --api-key KEY]")
+	fmt.Println("  immich-importer <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Println()
+	fmt.Println("Run 'immich-importer help <command>' for details on a command.")
+}
+
+// newFlagSet creates the flag set for a command, with help output built from its description
+func newFlagSet(name, description string) *flag.FlagSet {
+	cmd := findCommand(name)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Printf("Usage: immich-importer %s %s\n\n", cmd.name, cmd.args)
+		fmt.Println(description)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Println()
+			fmt.Println("Flags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// importFlags are the importer options shared by the commands that import
+type importFlags struct {
+	livePhotos *string
+	edited     *string
+	noStack    *bool
+	trashed    *string
+	peopleTags *string
+	deviceID   *string
+	jobTag     *string
+	jobAlbum   *string
+}
+
+func addImportFlags(fs *flag.FlagSet) *importFlags {
+	return &importFlags{
+		livePhotos: fs.String("live-photos", string(importer.LivePhotoLink), "Live Photo videos: link (attach to the still), hide, or separate"),
+		noStack:    fs.Bool("no-stack", false, "Do not stack RAW+JPEG pairs and burst sequences"),
+		trashed:    fs.String("trashed", string(importer.TrashSkip), "Items from the Google Photos trash: skip, or trash (import into the Immich trash)"),
+		edited:     fs.String("edited", string(importer.EditedStack), "\"-edited\" copies: stack (edited on top), original (skip edited copies), or edited (skip originals)"),
+		deviceID:   fs.String("device-id", importer.DefaultDeviceID, "Device ID Immich records for the uploads of a new job"),
+		jobTag:     fs.String("job-tag", importer.DefaultJobTag, "Tag added to every asset of a new job ({job} is the job ID), or \"none\""),
+		jobAlbum:   fs.String("job-album", "", "Album every asset of a new job is added to ({job} is the job ID)"),
+		peopleTags: fs.String("people-tags", importer.DefaultPeopleTagPrefix, "Parent tag for people named in Google Photos (e.g. People/Alice), or \"none\" to not tag people"),
+	}
+}
+
+// options converts the flags to importer options, exiting on invalid values
+func (f *importFlags) options() importer.Options {
+	livePhotos, err := importer.ParseLivePhotoPolicy(*f.livePhotos)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	edited, err := importer.ParseEditedPolicy(*f.edited)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	trashed, err := importer.ParseTrashPolicy(*f.trashed)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	options := importer.Options{
+		LivePhotos:      livePhotos,
+		Edited:          edited,
+		NoAutoStack:     *f.noStack,
+		Trashed:         trashed,
+		PeopleTagPrefix: strings.Trim(*f.peopleTags, "/"),
+		DeviceID:        *f.deviceID,
+		JobTag:          *f.jobTag,
+		JobAlbum:        *f.jobAlbum,
+	}
+	if options.JobTag == "none" {
+		options.JobTag = ""
+	}
+	if options.PeopleTagPrefix == "none" {
+		options.NoPeopleTags = true
+	}
+	return options
+}
+
+func runHelpCommand(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		return
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		printUsage()
+		return
+	}
+	cmd.run([]string{"-h"})
+}
+
+func runImportCommand(args []string) {
+	fs := newFlagSet("import", "Runs the import job: resumes an unfinished job, or starts a new one\nfrom the Takeout files in your Drive.")
+	serverURL := fs.String("server", "", "Immich server URL (first run only)")
+	apiKey := fs.String("api-key", "", "Immich API key (first run only)")
+	token := fs.String("token", "", "Setup token from Immich server (first run only)")
+	all := fs.Bool("all", false, "Import all Takeout files without asking")
+	fresh := fs.Bool("new", false, "Start a new job even if an unfinished one exists")
+	dryRun := fs.Bool("dry-run", false, "Scan downloaded archives offline and report what would be uploaded")
+	importOpts := addImportFlags(fs)
+	fs.Parse(args)
+	options := importOpts.options()
+
+	if *dryRun {
+		runDryRun(options)
+		return
+	}
+
+	printBanner()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	cfg := setupConfig(*serverURL, *apiKey, *token)
+	googleClient := connectGoogle(cfg, "")
+
+	jobState, err := state.Load()
+	if err != nil && !*fresh {
+		exitLoadError(err)
+	}
+	if jobState != nil && (*fresh || jobState.Finished() || len(jobState.Files) == 0) {
+		jobState = nil
+	}
+	if jobState != nil {
+		fmt.Printf("Resuming import job %s (status: %s)\n", jobState.ID, jobState.Status)
+	} else {
+		jobState = newJob(cfg, googleClient, *all)
+	}
+
+	startImport(ctx, cfg, jobState, googleClient, options)
+}
+
+// runDryRun classifies the downloaded archives of the current job using the
+// bundled media types, without contacting any server
+func runDryRun(options importer.Options) {
+	jobState, err := state.Load()
+	if err != nil {
+		exitLoadError(err)
+	}
+	if jobState == nil {
+		fmt.Println("No import job found.")
+		return
+	}
+
+	imp := importer.New(jobState.ServerURL, "", options)
+	total, err := imp.Scan(jobState)
+	if err != nil {
+		fmt.Printf("Error: Scan failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, f := range jobState.Files {
+		if !f.Downloaded {
+			fmt.Printf("Not downloaded yet, not scanned: %s\n", f.Name)
+		}
+	}
+	fmt.Printf("%d asset(s) would be uploaded.\n", total)
+	printReport(imp.Report())
+}
+
+func runRetryCommand(args []string) {
+	fs := newFlagSet("retry", "Resumes the current import job without prompting. Completed downloads and\nuploads are skipped; everything else is attempted again.")
+	importOpts := addImportFlags(fs)
+	fs.Parse(args)
+	options := importOpts.options()
+
+	jobState, err := state.Load()
+	if err != nil {
+		exitLoadError(err)
+	}
+	if jobState == nil || len(jobState.Files) == 0 {
+		fmt.Println("No import job to retry.")
+		os.Exit(1)
+	}
+
+	resumeJob(jobState, options)
+}
+
+// resumeJob continues an unfinished job without prompting
+func resumeJob(jobState *state.JobState, options importer.Options) {
+	switch {
+	case jobState.Status == "complete":
+		fmt.Println("The import job is already complete.")
+		return
+	case jobState.Status == "rolled-back":
+		fmt.Println("The import job was rolled back. Run 'immich-importer import --new' to import again.")
+		return
+	case len(jobState.Files) == 0:
+		fmt.Println("The import job has no files to import.")
+		os.Exit(1)
+	}
+
+	printBanner()
+	fmt.Printf("Resuming import job %s (status: %s)\n", jobState.ID, jobState.Status)
+	if jobState.LastError != "" {
+		fmt.Printf("Previous error: %s\n", jobState.LastError)
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	cfg := loadConfig()
+	googleClient := connectGoogle(cfg, "")
+	startImport(ctx, cfg, jobState, googleClient, options)
+}
+
+func runStatusCommand(args []string) {
+	fs := newFlagSet("status", "Shows the current import job, its files and download/upload progress.")
+	fs.Parse(args)
+
+	jobState, err := state.Load()
+	if err != nil {
+		exitLoadError(err)
+	}
+	if jobState == nil {
+		fmt.Println("No import job found.")
+		return
+	}
+
+	printJob(jobState)
+}
+
+// printJob shows a job, its files and download/upload progress
+func printJob(jobState *state.JobState) {
+	fmt.Printf("Job:      %s\n", jobState.ID)
+	fmt.Printf("Server:   %s\n", jobState.ServerURL)
+	fmt.Printf("Status:   %s\n", jobState.Status)
+	fmt.Printf("Created:  %s\n", jobState.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Updated:  %s\n", jobState.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if jobState.LastError != "" {
+		fmt.Printf("Error:    %s\n", jobState.LastError)
+	}
+	if jobState.DeviceID != "" {
+		fmt.Printf("Device:   %s\n", jobState.DeviceID)
+	}
+	if jobState.Tag != "" {
+		fmt.Printf("Tag:      %s\n", jobState.Tag)
+	}
+	if jobState.Album != "" {
+		fmt.Printf("Album:    %s\n", jobState.Album)
+	}
+
+	fmt.Println()
+	fmt.Printf("Download: %.1f%%\n", jobState.GetDownloadProgress())
+	for _, f := range jobState.Files {
+		done := "pending"
+		if f.Downloaded {
+			done = "downloaded"
+		} else if f.BytesDownloaded > 0 {
+			done = fmt.Sprintf("%.1f%%", float64(f.BytesDownloaded)/float64(max(f.Size, 1))*100)
+		}
+		fmt.Printf("  %s (%.2f MB) - %s\n", f.Name, float64(f.Size)/1024/1024, done)
+	}
+
+	fmt.Println()
+	fmt.Printf("Upload:   %.1f%%", jobState.GetUploadProgress())
+	if jobState.UploadState != nil {
+		fmt.Printf(" (%d of %d photos)", jobState.UploadState.UploadedPhotos, jobState.UploadState.TotalPhotos)
+	}
+	fmt.Println()
+	if us := jobState.UploadState; us != nil && us.CreatedAssets+us.DuplicateAssets+us.ReplacedAssets > 0 {
+		fmt.Printf("  %d new, %d duplicate", us.CreatedAssets, us.DuplicateAssets)
+		if us.ReplacedAssets > 0 {
+			fmt.Printf(", %d replaced", us.ReplacedAssets)
+		}
+		fmt.Println()
+	}
+}
+
+// runJobsCommand handles "immich-importer jobs <subcommand>"
+func runJobsCommand(args []string) {
+	fs := newFlagSet("jobs", "Lists, inspects and resumes import jobs. Every job is kept after it finishes,\nso it can still be rolled back.\n\n  list             List all import jobs\n  show <job-id>    Show a job, its files and progress\n  resume <job-id>  Resume a job without prompting; takes the import flags\n\nA job ID may be shortened to any prefix that matches only one job.")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	switch sub, rest := strings.ToLower(fs.Arg(0)), fs.Args()[1:]; {
+	case sub == "list" && len(rest) == 0:
+		listJobs()
+	case sub == "show" && len(rest) == 1:
+		printJob(loadJob(rest[0]))
+	case sub == "resume":
+		resumeFs := flag.NewFlagSet("jobs resume", flag.ExitOnError)
+		resumeFs.Usage = fs.Usage
+		importOpts := addImportFlags(resumeFs)
+		resumeFs.Parse(rest)
+		if resumeFs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		options := importOpts.options()
+		resumeJob(loadJob(resumeFs.Arg(0)), options)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// listJobs prints one line per import job, oldest first
+func listJobs() {
+	jobs, err := state.ListJobs()
+	if err != nil {
+		fmt.Printf("Error: Could not load state: %v\n", err)
+		os.Exit(1)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No import jobs found.")
+		return
+	}
+
+	fmt.Printf("%-32s  %-12s  %-16s  %-16s  %s\n", "ID", "STATUS", "CREATED", "UPDATED", "UPLOADED")
+	var broken []*state.JobState
+	for _, job := range jobs {
+		if job.LoadErr != nil {
+			broken = append(broken, job)
+		}
+		uploaded := "-"
+		if us := job.UploadState; us != nil {
+			uploaded = fmt.Sprintf("%d of %d photos", us.UploadedPhotos, us.TotalPhotos)
+		}
+		fmt.Printf("%-32s  %-12s  %-16s  %-16s  %s\n", job.ID, job.Status,
+			job.CreatedAt.Format("2006-01-02 15:04"), job.UpdatedAt.Format("2006-01-02 15:04"), uploaded)
+	}
+
+	if len(broken) > 0 {
+		fmt.Println()
+		for _, job := range broken {
+			fmt.Printf("Warning: %v\n", job.LoadErr)
+		}
+		fmt.Println("Run 'immich-importer reset <job-id>' to remove a broken job.")
+	}
+}
+
+// loadJob loads the job with the given ID or ID prefix, exiting if there is none
+func loadJob(id string) *state.JobState {
+	jobState, err := state.LoadJob(id)
+	if errors.Is(err, state.ErrJobNotFound) {
+		fmt.Printf("Error: Import job %s not found. Run 'immich-importer jobs list' to see all jobs.\n", id)
+		os.Exit(1)
+	}
+	if err != nil {
+		exitLoadError(err)
+	}
+	return jobState
+}
+
+// lockJob locks a job for this process, exiting if it is running in another
+func lockJob(jobState *state.JobState) {
+	err := jobState.Lock()
+	if errors.Is(err, state.ErrJobLocked) {
+		fmt.Printf("Error: Import job %s is running in another process.\n", jobState.ID)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// exitLoadError reports that a job could not be loaded, with how to remove it
+// if it is broken, and exits
+func exitLoadError(err error) {
+	fmt.Printf("Error: Could not load state: %v\n", err)
+	var broken *state.BrokenJobError
+	if errors.As(err, &broken) {
+		fmt.Printf("Run 'immich-importer reset %s' to remove the broken job.\n", broken.ID)
+	}
+	os.Exit(1)
+}
+
+func runListCommand(args []string) {
+	fs := newFlagSet("list", "Lists the Google Takeout files in your Drive.")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+	googleClient := connectGoogle(cfg, "")
+	listTakeoutFiles(googleClient)
+}
+
+func runResetCommand(args []string) {
+	fs := newFlagSet("reset", "Forgets the current import job, or the job with the given ID. Downloaded\nfiles are kept; use 'cleanup' to delete them. A job whose state cannot be\nloaded is removed as well.")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var jobState *state.JobState
+	var err error
+	if fs.NArg() == 1 {
+		jobState, err = state.LoadJob(fs.Arg(0))
+	} else {
+		jobState, err = state.Load()
+	}
+
+	var broken *state.BrokenJobError
+	switch {
+	case errors.As(err, &broken):
+		fmt.Printf("Import job %s cannot be loaded: %v\n", broken.ID, broken.Err)
+		fmt.Println("This will remove it. What it uploaded is kept in Immich, but can no longer be rolled back.")
+	case errors.Is(err, state.ErrJobNotFound):
+		fmt.Printf("Error: Import job %s not found. Run 'immich-importer jobs list' to see all jobs.\n", fs.Arg(0))
+		os.Exit(1)
+	case err != nil:
+		fmt.Printf("Error: Could not load state: %v\n", err)
+		os.Exit(1)
+	case jobState == nil:
+		fmt.Println("No import job found.")
+		return
+	default:
+		fmt.Printf("This will forget import job %s (status: %s).\n", jobState.ID, jobState.Status)
+		if jobState.UploadState != nil && jobState.Status != "rolled-back" {
+			fmt.Println("What it uploaded is kept in Immich, but can no longer be rolled back.")
+		}
+	}
+
+	if !*yes && !confirm("Reset the import job?", false) {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	if broken != nil {
+		err = state.RemoveJob(broken.ID)
+	} else {
+		err = jobState.Remove()
+	}
+	if err != nil {
+		fmt.Printf("Error: Failed to reset: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Import job reset.")
+}
+
+func runRollbackCommand(args []string) {
+	fs := newFlagSet("rollback", "Deletes the assets and albums an import job created in Immich. Assets that\nwere on the server before the job are kept. Safe to run again after a failure.")
+	force := fs.Bool("force", false, "Delete assets permanently instead of moving them to the trash")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	jobID := fs.Arg(0)
+
+	jobState := loadJob(jobID)
+	lockJob(jobState)
+	if jobState.UploadState == nil {
+		fmt.Println("The job has nothing in Immich to roll back.")
+		return
+	}
+	uploadState, err := jobState.OpenUploadState()
+	if err != nil {
+		fmt.Printf("Error: Could not load state: %v\n", err)
+		os.Exit(1)
+	}
+	assets := len(uploadState.CreatedAssetIDs())
+	albums := len(uploadState.CreatedAlbums)
+	jobState.Close()
+	if assets == 0 && albums == 0 {
+		fmt.Println("The job has nothing in Immich to roll back.")
+		return
+	}
+
+	cfg := loadConfig()
+	if jobState.ServerURL != "" && jobState.ServerURL != cfg.ServerURL {
+		fmt.Printf("Error: The job uploaded to %s, but the configured server is %s.\n", jobState.ServerURL, cfg.ServerURL)
+		os.Exit(1)
+	}
+
+	action := "move to the trash"
+	if *force {
+		action = "permanently delete"
+	}
+	fmt.Printf("This will %s %d asset(s) and delete %d album(s) created by job %s.\n", action, assets, albums, jobState.ID)
+	if !*yes && !confirm("Roll back the import job?", false) {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	imp := importer.New(cfg.ServerURL, cfg.APIKey, importer.Options{})
+	deleted, err := imp.Rollback(ctx, jobState, *force)
+	fmt.Printf("Deleted %d asset(s).\n", deleted)
+	if err != nil {
+		printError("Rollback failed", err)
+		fmt.Printf("Run 'immich-importer rollback %s' again to continue.\n", jobState.ID)
+		os.Exit(1)
+	}
+	fmt.Println("Import job rolled back.")
+}
+
+func runCleanupCommand(args []string) {
+	fs := newFlagSet("cleanup", "Deletes downloaded Takeout files. An unfinished job will download them\nagain when resumed. The downloads of a running job are kept.")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Parse(args)
+
+	downloadDir, err := config.GetDownloadDir()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Lock every job while its downloads are deleted; a running job keeps its
+	// download directory and the files it is downloading
+	jobs, err := state.ListJobs()
+	if err != nil {
+		fmt.Printf("Error: Could not load state: %v\n", err)
+		os.Exit(1)
+	}
+	keep := make(map[string]bool)
+	var idle []*state.JobState
+	for _, job := range jobs {
+		err := job.Lock()
+		if errors.Is(err, state.ErrJobLocked) {
+			fmt.Printf("Note: import job %s is running, its downloads are kept.\n", job.ID)
+			keep[job.ID] = true
+			for _, f := range job.Files {
+				if f.LocalPath != "" && filepath.Dir(f.LocalPath) == downloadDir {
+					keep[filepath.Base(f.LocalPath)] = true
+				}
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer job.Unlock()
+		idle = append(idle, job)
+	}
+
+	entries, err := os.ReadDir(downloadDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var deletable []os.DirEntry
+	var totalSize int64
+	for _, e := range entries {
+		if keep[e.Name()] {
+			continue
+		}
+		deletable = append(deletable, e)
+		filepath.WalkDir(filepath.Join(downloadDir, e.Name()), func(_ string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					totalSize += info.Size()
+				}
+			}
+			return nil
+		})
+	}
+	if len(deletable) == 0 {
+		fmt.Println("No downloaded files.")
+		return
+	}
+	fmt.Printf("%d download(s) (%.2f MB) in %s\n", len(deletable), float64(totalSize)/1024/1024, downloadDir)
+
+	for _, job := range idle {
+		if job.LoadErr == nil && !job.Finished() {
+			fmt.Printf("Note: import job %s is not complete (status: %s).\n", job.ID, job.Status)
+		}
+	}
+
+	if !*yes && !confirm("Delete downloaded files?", false) {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	for _, e := range deletable {
+		if err := os.RemoveAll(filepath.Join(downloadDir, e.Name())); err != nil {
+			fmt.Printf("Warning: could not delete %s: %v\n", e.Name(), err)
+		}
+	}
+
+	// Make sure unfinished jobs download the files again
+	for _, job := range idle {
+		if job.LoadErr != nil || job.Finished() {
+			continue
+		}
+		for i := range job.Files {
+			job.Files[i].Downloaded = false
+			job.Files[i].BytesDownloaded = 0
+			job.Files[i].LocalPath = ""
+		}
+		job.Save()
+	}
+	fmt.Println("Downloads deleted.")
+}
+
+// runConfigCommand handles "immich-importer config <subcommand>"
+func runConfigCommand(args []string) {
+	fs := newFlagSet("config", "Manages the stored configuration.\n\n  rekey   Re-encrypt the stored configuration with a new passphrase")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || strings.ToLower(fs.Arg(0)) != "rekey" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg := loadConfig()
+	if err := cfg.Rekey(); err != nil {
+		fmt.Printf("Error: Failed to rekey config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Configuration re-encrypted with the new passphrase.")
+}
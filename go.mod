@@ -2,4 +2,11 @@ module github.com/davidaniva/immich-importer
 
 go 1.22
 
-require golang.org/x/oauth2 v0.24.0
+require (
+	golang.org/x/crypto v0.31.0
+	golang.org/x/oauth2 v0.24.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/term v0.27.0
+)
+
+require cloud.google.com/go/compute/metadata v0.3.0 // indirect
@@ -1,24 +1,36 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
+
+	"github.com/davidaniva/immich-importer/internal/fsutil"
+	"github.com/davidaniva/immich-importer/internal/immich"
 )
 
 // Config holds the application configuration
 type Config struct {
-	ServerURL          string    `json:"serverUrl"`
-	APIKey             string    `json:"apiKey"`
+	// SchemaVersion is the format the config was saved in, see migrations
+	SchemaVersion int `json:"schemaVersion"`
+
+	ServerURL          string      `json:"serverUrl"`
+	APIKey             string      `json:"apiKey"`
 	OAuth              OAuthConfig `json:"oauth"`
-	GoogleAccessToken  string    `json:"googleAccessToken,omitempty"`
-	GoogleRefreshToken string    `json:"googleRefreshToken,omitempty"`
-	GoogleTokenExpiry  time.Time `json:"googleTokenExpiry,omitempty"`
+	GoogleAccessToken  string      `json:"googleAccessToken,omitempty"`
+	GoogleRefreshToken string      `json:"googleRefreshToken,omitempty"`
+	GoogleTokenExpiry  time.Time   `json:"googleTokenExpiry,omitempty"`
+
+	// key encrypts the config on Save, set once the config has been unlocked
+	key *sealKey
 }
 
 // OAuthConfig holds Google OAuth credentials
@@ -27,73 +39,51 @@ type OAuthConfig struct {
 	ClientSecret string `json:"clientSecret"`
 }
 
-// ServerConfigResponse is the response from /api/importer/config/:token
-type ServerConfigResponse struct {
-	ServerURL string `json:"serverUrl"`
-	APIKey    string `json:"apiKey"`
-	OAuth     struct {
-		ClientID     string `json:"clientId"`
-		ClientSecret string `json:"clientSecret"`
-	} `json:"oauth"`
-}
-
 // HasGoogleTokens returns true if Google tokens are stored
 func (c *Config) HasGoogleTokens() bool {
 	return c.GoogleAccessToken != "" && c.GoogleRefreshToken != ""
 }
 
-// SetupTokenResponse is the response from POST /api/importer/setup-token
-type SetupTokenResponse struct {
-	Token string `json:"token"`
-}
+// ErrSetupTokenInvalid is returned when the server rejects a setup token,
+// usually because it has expired or was already revoked
+var ErrSetupTokenInvalid = errors.New("setup token is invalid or has expired")
+
+// ErrAPIKeyRejected is returned when the server does not accept an API key
+var ErrAPIKeyRejected = errors.New("API key was rejected by the server")
 
 // CreateSetupToken creates a setup token using an API key
 func CreateSetupToken(serverURL, apiKey string) (string, error) {
-	url := fmt.Sprintf("%s/api/importer/setup-token", serverURL)
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	token, err := immich.New(serverURL, apiKey).CreateSetupToken(context.Background())
+	if immich.IsUnauthorized(err) {
+		return "", fmt.Errorf("%w (%v)", ErrAPIKeyRejected, err)
 	}
-	req.Header.Set("x-api-key", apiKey)
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to server: %w", err)
+		return "", fmt.Errorf("failed to create setup token: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result SetupTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return result.Token, nil
+	return token, nil
 }
 
-// FetchFromServer fetches config from the Immich server
+// FetchFromServer fetches config from the Immich server using a setup token.
+// It returns an error wrapping ErrSetupTokenInvalid if the token is rejected.
 func FetchFromServer(serverURL, token string) (*Config, error) {
-	url := fmt.Sprintf("%s/api/importer/config/%s", serverURL, token)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to server: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, "/?# ") {
+		return nil, fmt.Errorf("%w: malformed token", ErrSetupTokenInvalid)
 	}
 
-	var serverResp ServerConfigResponse
-	if err := json.NewDecoder(resp.Body).Decode(&serverResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	serverResp, err := immich.New(serverURL, "").ImporterConfig(context.Background(), token)
+	if err != nil {
+		switch immich.StatusCode(err) {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			return nil, fmt.Errorf("%w (%v)", ErrSetupTokenInvalid, err)
+		case 0:
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				return nil, fmt.Errorf("failed to connect to server: %w", err)
+			}
+			return nil, fmt.Errorf("unexpected response from server: %w", err)
+		}
+		return nil, err
 	}
 
 	return &Config{
@@ -106,7 +96,9 @@ func FetchFromServer(serverURL, token string) (*Config, error) {
 	}, nil
 }
 
-// Load loads config from disk
+// Load loads config from disk, decrypting it with the passphrase from
+// PassphraseEnv or a prompt, and migrating it from an older schema version.
+// A legacy plaintext config is encrypted in place.
 func Load() (*Config, error) {
 	path, err := configPath()
 	if err != nil {
@@ -121,15 +113,63 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	env, err := parseEnvelope(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
 	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+	if env == nil {
+		// Legacy plaintext config: migrate it to the encrypted format
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		key, plaintext, err := unlock(env)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(plaintext, &cfg); err != nil {
+			return nil, err
+		}
+		cfg.key = key
+	}
+
+	if cfg.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("config was saved by a newer version of immich-importer (schema version %d, this version supports up to %d)", cfg.SchemaVersion, SchemaVersion)
+	}
+	if env != nil && cfg.SchemaVersion == SchemaVersion {
+		return &cfg, nil
 	}
 
+	if env == nil {
+		fmt.Fprintln(os.Stderr, "Your config.json is stored unencrypted and will now be encrypted.")
+	}
+	from := cfg.SchemaVersion
+	if err := fsutil.WriteBackup(path, data, from); err != nil {
+		return nil, fmt.Errorf("failed to back up config before migrating: %w", err)
+	}
+	for ; cfg.SchemaVersion < SchemaVersion; cfg.SchemaVersion++ {
+		if err := migrations[cfg.SchemaVersion](&cfg); err != nil {
+			return nil, fmt.Errorf("failed to migrate config from schema version %d: %w", cfg.SchemaVersion, err)
+		}
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save migrated config: %w", err)
+	}
+
+	// A plaintext backup is only kept until the config is encrypted: keeping
+	// the credentials in the clear would defeat the point
+	if env == nil {
+		if err := os.Remove(fsutil.BackupPath(path, from)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove unencrypted backup: %w", err)
+		}
+	}
 	return &cfg, nil
 }
 
-// Save saves config to disk
+// Save encrypts and saves config to disk. The first save of a new config
+// asks for a passphrase.
 func (c *Config) Save() error {
 	path, err := configPath()
 	if err != nil {
@@ -141,12 +181,53 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	data, err := json.MarshalIndent(c, "", "  ")
+	if c.key == nil {
+		passphrase, err := choosePassphrase(PassphraseEnv, "Choose a passphrase to encrypt your credentials: ")
+		if err != nil {
+			return err
+		}
+		if c.key, err = newSealKey(passphrase); err != nil {
+			return err
+		}
+	}
+
+	c.SchemaVersion = SchemaVersion
+	plaintext, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0600)
+	env, err := c.key.seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// Rekey re-encrypts the config with a new passphrase taken from
+// NewPassphraseEnv or a prompt
+func (c *Config) Rekey() error {
+	passphrase, err := choosePassphrase(NewPassphraseEnv, "New passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	key, err := newSealKey(passphrase)
+	if err != nil {
+		return err
+	}
+	c.key = key
+
+	return c.Save()
 }
 
 func configPath() (string, error) {
@@ -192,6 +273,11 @@ func appDataDir() (string, error) {
 	return baseDir, nil
 }
 
+// GetConfigPath returns the path of the config file
+func GetConfigPath() (string, error) {
+	return configPath()
+}
+
 // GetDownloadDir returns the directory for downloaded files
 func GetDownloadDir() (string, error) {
 	dir, err := appDataDir()
@@ -204,3 +290,17 @@ func GetDownloadDir() (string, error) {
 	}
 	return downloadDir, nil
 }
+
+// GetJobDownloadDir returns the directory an import job downloads its files
+// to, so jobs running at the same time never share a file
+func GetJobDownloadDir(jobID string) (string, error) {
+	downloadDir, err := GetDownloadDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(downloadDir, jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// useTempDir points the app data directory at a temporary directory
+func useTempDir(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("APPDATA", home)
+	t.Setenv(PassphraseEnv, testPassphrase)
+	dir, err := appDataDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	if len(migrations) != SchemaVersion {
+		t.Errorf("%d migrations for schema version %d", len(migrations), SchemaVersion)
+	}
+}
+
+// Each fixture is the same config, saved in a format an earlier version wrote
+func TestLoadPreviousVersions(t *testing.T) {
+	tests := []struct {
+		fixture string
+		backup  bool
+	}{
+		{"v0-plaintext.json", false},
+		{"v0-encrypted.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			dir := useTempDir(t)
+			path := filepath.Join(dir, "config.json")
+			original, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, original, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load()
+			if err != nil || cfg == nil {
+				t.Fatalf("Load: %v, %v", cfg, err)
+			}
+			if cfg.SchemaVersion != SchemaVersion {
+				t.Errorf("SchemaVersion = %d, want %d", cfg.SchemaVersion, SchemaVersion)
+			}
+			if cfg.ServerURL != "https://immich.example.com" || cfg.APIKey != "api-key-1" ||
+				cfg.OAuth.ClientSecret != "client-secret-1" || cfg.GoogleRefreshToken != "refresh-token-1" ||
+				!cfg.GoogleTokenExpiry.Equal(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)) {
+				t.Errorf("config not kept: %+v", cfg)
+			}
+
+			saved, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env, err := parseEnvelope(saved); err != nil || env == nil || strings.Contains(string(saved), "api-key-1") {
+				t.Errorf("migrated config not encrypted:\n%s", saved)
+			}
+
+			backup, err := os.ReadFile(filepath.Join(dir, "config.json.v0.bak"))
+			if tt.backup && (err != nil || string(backup) != string(original)) {
+				t.Errorf("config not backed up: %v", err)
+			}
+			if !tt.backup && !os.IsNotExist(err) {
+				t.Errorf("plaintext config backed up: %v", err)
+			}
+
+			// The migrated config loads as it is
+			again, err := Load()
+			if err != nil || again.SchemaVersion != SchemaVersion || again.APIKey != cfg.APIKey {
+				t.Errorf("migrated config loaded again: %+v, %v", again, err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != string(saved) {
+				t.Error("migrated config was saved again")
+			}
+		})
+	}
+}
+
+func TestNewerVersionIsNotLoaded(t *testing.T) {
+	dir := useTempDir(t)
+	path := filepath.Join(dir, "config.json")
+
+	newer := fmt.Sprintf(`{"schemaVersion": %d, "serverUrl": "https://immich.example.com"}`, SchemaVersion+1)
+	if err := os.WriteFile(path, []byte(newer), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Load of a newer config returned %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != newer {
+		t.Error("newer config was changed")
+	}
+}
+
+func TestFetchFromServerErrors(t *testing.T) {
+	garbled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>Welcome to nginx!</html>"))
+	}))
+	defer garbled.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"not an Immich response", garbled.URL, "unexpected response from server"},
+		{"server down", down.URL, "failed to connect to server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FetchFromServer(tt.url, "token")
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("FetchFromServer = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaintextBackupKeptUntilEncrypted(t *testing.T) {
+	dir := useTempDir(t)
+	path := filepath.Join(dir, "config.json")
+	original, err := os.ReadFile(filepath.Join("testdata", "v0-plaintext.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// No passphrase can be chosen, so the config cannot be encrypted
+	t.Setenv(PassphraseEnv, "")
+	prompt := PromptPassphrase
+	PromptPassphrase = func(string) (string, error) { return "", fmt.Errorf("no terminal") }
+	defer func() { PromptPassphrase = prompt }()
+
+	if _, err := Load(); err == nil {
+		t.Fatal("Load succeeded without a passphrase")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != string(original) {
+		t.Errorf("config changed by the failed migration: %v", err)
+	}
+	if backup, err := os.ReadFile(filepath.Join(dir, "config.json.v0.bak")); err != nil || string(backup) != string(original) {
+		t.Errorf("plaintext config not backed up: %v", err)
+	}
+}
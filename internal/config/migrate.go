@@ -0,0 +1,12 @@
+package config
+
+// SchemaVersion is the version of the config format this build writes.
+// Configs without a version, plaintext or encrypted, are version 0.
+const SchemaVersion = 1
+
+// migrations upgrade a config from the schema version of their index to the
+// next. Encrypting a plaintext config is not one of them: Save always
+// encrypts.
+var migrations = []func(c *Config) error{
+	0: func(c *Config) error { return nil }, // only adds the schema version
+}
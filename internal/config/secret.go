@@ -0,0 +1,201 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is checked for the config passphrase before prompting
+const PassphraseEnv = "IMMICH_IMPORTER_PASSPHRASE"
+
+// NewPassphraseEnv is checked for the new passphrase during a rekey before prompting
+const NewPassphraseEnv = "IMMICH_IMPORTER_NEW_PASSPHRASE"
+
+// PromptPassphrase reads a passphrase from the user. It defaults to a
+// terminal prompt without echo.
+var PromptPassphrase = promptTerminal
+
+// ErrWrongPassphrase is returned when the config cannot be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted config")
+
+// Default scrypt cost parameters (recommended interactive values)
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	keyLength    = 32
+	saltLength   = 16
+	envelopeKind = "scrypt-aes256gcm"
+)
+
+// encryptedFile is the on-disk format of an encrypted config.json
+type encryptedFile struct {
+	Encrypted  string `json:"encrypted"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// sealKey is a passphrase-derived key together with its derivation parameters
+type sealKey struct {
+	salt    []byte
+	n, r, p int
+	key     []byte
+}
+
+func deriveKey(passphrase string, salt []byte, n, r, p int) (*sealKey, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return &sealKey{salt: salt, n: n, r: r, p: p, key: key}, nil
+}
+
+func newSealKey(passphrase string) (*sealKey, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return deriveKey(passphrase, salt, scryptN, scryptR, scryptP)
+}
+
+func (k *sealKey) seal(plaintext []byte) (*encryptedFile, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &encryptedFile{
+		Encrypted:  envelopeKind,
+		Salt:       k.salt,
+		N:          k.n,
+		R:          k.r,
+		P:          k.p,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, []byte(envelopeKind)),
+	}, nil
+}
+
+func (k *sealKey) open(env *encryptedFile) ([]byte, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, env.Nonce, env.Ciphertext, []byte(env.Encrypted))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// parseEnvelope returns the encrypted envelope if data is an encrypted config,
+// or nil if it is a legacy plaintext config
+func parseEnvelope(data []byte) (*encryptedFile, error) {
+	var env encryptedFile
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	if env.Encrypted == "" {
+		return nil, nil
+	}
+	if env.Encrypted != envelopeKind {
+		return nil, fmt.Errorf("unsupported config encryption %q", env.Encrypted)
+	}
+	return &env, nil
+}
+
+// unlock derives the key for an existing envelope from the env var or a prompt
+func unlock(env *encryptedFile) (*sealKey, []byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		key, err := deriveKey(passphrase, env.Salt, env.N, env.R, env.P)
+		if err != nil {
+			return nil, nil, err
+		}
+		plaintext, err := key.open(env)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", PassphraseEnv, err)
+		}
+		return key, plaintext, nil
+	}
+
+	// Give the user a few attempts at the prompt
+	for attempt := 0; attempt < 3; attempt++ {
+		passphrase, err := PromptPassphrase("Config passphrase: ")
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := deriveKey(passphrase, env.Salt, env.N, env.R, env.P)
+		if err != nil {
+			return nil, nil, err
+		}
+		plaintext, err := key.open(env)
+		if err == nil {
+			return key, plaintext, nil
+		}
+		fmt.Fprintln(os.Stderr, "Wrong passphrase, try again.")
+	}
+	return nil, nil, ErrWrongPassphrase
+}
+
+// choosePassphrase gets a new passphrase from envName or asks for one twice
+func choosePassphrase(envName, prompt string) (string, error) {
+	if passphrase := os.Getenv(envName); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := PromptPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+	confirm, err := PromptPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func promptTerminal(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no passphrase available: set %s or run in a terminal", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
@@ -1,12 +1,16 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/davidaniva/immich-importer/internal/config"
 	"github.com/davidaniva/immich-importer/internal/google"
@@ -16,22 +20,86 @@ import (
 // Downloader handles resumable file downloads from Google Drive
 type Downloader struct {
 	google *google.Client
+	dir    string
+
+	// backoff returns how long to wait before the given retry (1, 2, ...)
+	backoff func(retry int) time.Duration
 }
 
-// New creates a new Downloader
+// Attempts per file before giving up. Throttling, server errors and dropped
+// connections are retried, resuming where the previous attempt stopped.
+const maxAttempts = 5
+
+// New creates a new Downloader that saves files in the download directory
 func New(googleClient *google.Client) *Downloader {
-	return &Downloader{google: googleClient}
+	return &Downloader{
+		google: googleClient,
+		backoff: func(retry int) time.Duration {
+			return time.Duration(1<<retry) * time.Second
+		},
+	}
+}
+
+// SetDir sets the directory files are saved in, instead of the download directory
+func (d *Downloader) SetDir(dir string) {
+	d.dir = dir
+}
+
+// retryableError is a failed attempt worth repeating
+type retryableError struct {
+	err error
+	// after is how long the server asked us to wait, if it did
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
 }
 
-// DownloadFile downloads a file with resume support
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// DownloadFile downloads a file with resume support. A file that already has
+// a local path is downloaded there, so a download started before is resumed
+// where it is.
 func (d *Downloader) DownloadFile(ctx context.Context, file *state.FileState) error {
-	downloadDir, err := config.GetDownloadDir()
-	if err != nil {
-		return err
+	if file.LocalPath == "" {
+		dir := d.dir
+		if dir == "" {
+			var err error
+			if dir, err = config.GetDownloadDir(); err != nil {
+				return err
+			}
+		}
+		file.LocalPath = filepath.Join(dir, file.Name)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = d.download(ctx, file)
+
+		var retryErr *retryableError
+		if err == nil || !errors.As(err, &retryErr) || attempt == maxAttempts {
+			break
+		}
+
+		wait := retryErr.after
+		if wait == 0 {
+			wait = d.backoff(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
 	}
+	return err
+}
 
-	localPath := filepath.Join(downloadDir, file.Name)
-	file.LocalPath = localPath
+// download makes one attempt at downloading the rest of a file
+func (d *Downloader) download(ctx context.Context, file *state.FileState) error {
+	localPath := file.LocalPath
 
 	// Check if file already exists and get size
 	var startByte int64 = 0
@@ -49,12 +117,33 @@ func (d *Downloader) DownloadFile(ctx context.Context, file *state.FileState) er
 	// Download with range header for resume
 	resp, err := d.google.DownloadFileRange(ctx, file.DriveID, startByte)
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &retryableError{err: fmt.Errorf("failed to download: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	// Check response
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK:
+		// The server sent the whole file; start over rather than append it
+		startByte = 0
+		file.BytesDownloaded = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && startByte > 0 && file.Size == 0:
+		// Nothing left to download
+		file.Downloaded = true
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		after, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &retryableError{
+			err:   fmt.Errorf("download failed with status: %s", resp.Status),
+			after: time.Duration(after) * time.Second,
+		}
+	case resp.StatusCode == http.StatusForbidden && rateLimited(resp.Body):
+		return &retryableError{err: fmt.Errorf("download failed with status: %s (rate limit exceeded)", resp.Status)}
+	default:
 		return fmt.Errorf("download failed with status: %s", resp.Status)
 	}
 
@@ -93,14 +182,29 @@ func (d *Downloader) DownloadFile(ctx context.Context, file *state.FileState) er
 			break
 		}
 		if readErr != nil {
-			return fmt.Errorf("failed to read: %w", readErr)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// The connection dropped; what was written is kept for the next attempt
+			return &retryableError{err: fmt.Errorf("failed to read: %w", readErr)}
 		}
 	}
 
+	if file.Size > 0 && file.BytesDownloaded != file.Size {
+		return &retryableError{err: fmt.Errorf("download incomplete: got %d of %d bytes", file.BytesDownloaded, file.Size)}
+	}
+
 	file.Downloaded = true
 	return nil
 }
 
+// rateLimited reports whether a 403 response is Drive's rate limit rather than
+// a permission error
+func rateLimited(body io.Reader) bool {
+	data, _ := io.ReadAll(io.LimitReader(body, 64*1024))
+	return bytes.Contains(data, []byte("RateLimitExceeded")) || bytes.Contains(data, []byte("rateLimitExceeded"))
+}
+
 // DownloadProgress represents download progress
 type DownloadProgress struct {
 	FileIndex       int
@@ -0,0 +1,154 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/google"
+	"github.com/davidaniva/immich-importer/internal/google/drivetest"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// archive is large enough to take several reads
+var archive = bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+
+func setup(t *testing.T) (*drivetest.Server, *Downloader, *state.FileState) {
+	t.Helper()
+	srv := drivetest.NewServer(t)
+	id := srv.AddFile("takeout-001.zip", "application/zip", archive)
+
+	client, err := google.NewClientWithEndpoints(srv.Endpoints(), drivetest.OAuth, drivetest.AccessToken, drivetest.RefreshToken, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewClientWithEndpoints: %v", err)
+	}
+	d := New(client)
+	d.SetDir(t.TempDir())
+	d.backoff = func(int) time.Duration { return 0 }
+
+	file := &state.FileState{DriveID: id, Name: "takeout-001.zip", Size: int64(len(archive))}
+	return srv, d, file
+}
+
+func checkDownloaded(t *testing.T, file *state.FileState) {
+	t.Helper()
+	if !file.Downloaded || file.BytesDownloaded != int64(len(archive)) {
+		t.Errorf("file state = %+v", file)
+	}
+	got, err := os.ReadFile(file.LocalPath)
+	if err != nil {
+		t.Fatalf("reading download: %v", err)
+	}
+	if !bytes.Equal(got, archive) {
+		t.Errorf("downloaded %d bytes that differ from the %d byte archive", len(got), len(archive))
+	}
+}
+
+func TestDownload(t *testing.T) {
+	srv, d, file := setup(t)
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+	if got := srv.Ranges(file.DriveID); !reflect.DeepEqual(got, []int64{0}) {
+		t.Errorf("downloads started at %v, want [0]", got)
+	}
+}
+
+func TestResumeAfterDisconnect(t *testing.T) {
+	srv, d, file := setup(t)
+	srv.DisconnectAfter(file.DriveID, 100000)
+
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+
+	ranges := srv.Ranges(file.DriveID)
+	if len(ranges) != 2 || ranges[0] != 0 || ranges[1] == 0 || ranges[1] > 100000 {
+		t.Errorf("downloads started at %v, want a restart from where the connection dropped", ranges)
+	}
+}
+
+func TestRetryWhenThrottled(t *testing.T) {
+	srv, d, file := setup(t)
+	srv.Throttle(3)
+
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+}
+
+func TestGiveUpWhenThrottledTooOften(t *testing.T) {
+	srv, d, file := setup(t)
+	srv.Throttle(maxAttempts)
+
+	if err := d.DownloadFile(context.Background(), file); err == nil {
+		t.Fatal("DownloadFile succeeded while every attempt was throttled")
+	}
+	if file.Downloaded {
+		t.Error("file marked as downloaded")
+	}
+}
+
+func TestResumeFromPartialFile(t *testing.T) {
+	srv, d, file := setup(t)
+	if err := os.WriteFile(filepath.Join(d.dir, file.Name), archive[:12345], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+	if got := srv.Ranges(file.DriveID); !reflect.DeepEqual(got, []int64{12345}) {
+		t.Errorf("downloads started at %v, want [12345]", got)
+	}
+
+	// A complete file is not downloaded again
+	file.Downloaded = false
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if got := len(srv.Ranges(file.DriveID)); got != 1 {
+		t.Errorf("complete file downloaded again")
+	}
+}
+
+func TestServerIgnoringRange(t *testing.T) {
+	srv, d, file := setup(t)
+	srv.IgnoreRange(true)
+	if err := os.WriteFile(filepath.Join(d.dir, file.Name), archive[:12345], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+}
+
+func TestResumeWhereStarted(t *testing.T) {
+	srv, d, file := setup(t)
+	file.LocalPath = filepath.Join(t.TempDir(), file.Name)
+	if err := os.WriteFile(file.LocalPath, archive[:12345], 0644); err != nil {
+		t.Fatal(err)
+	}
+	started := file.LocalPath
+
+	if err := d.DownloadFile(context.Background(), file); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	checkDownloaded(t, file)
+	if file.LocalPath != started {
+		t.Errorf("download moved to %s, want %s", file.LocalPath, started)
+	}
+	if got := srv.Ranges(file.DriveID); !reflect.DeepEqual(got, []int64{12345}) {
+		t.Errorf("downloads started at %v, want [12345]", got)
+	}
+}
@@ -0,0 +1,78 @@
+// Package fsutil writes the importer's config and state files so that a crash
+// or power loss leaves them readable
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFileAtomic writes data to a temporary file in the same directory,
+// syncs it and renames it over path, so path holds either the old or the new
+// content even if the process dies or the power fails halfway
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // fails harmlessly once renamed
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself. Windows cannot sync directories.
+	if runtime.GOOS != "windows" {
+		if d, err := os.Open(dir); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
+
+// WriteBackup copies the file at path, whose content is data, to
+// <name>.v<version>.bak next to it. An existing backup is kept: it is from
+// before an earlier, interrupted attempt.
+func WriteBackup(path string, data []byte, version int) error {
+	f, err := os.OpenFile(BackupPath(path, version), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// BackupPath returns where WriteBackup puts the backup of path
+func BackupPath(path string, version int) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf("%s.v%d.bak", filepath.Base(path), version))
+}
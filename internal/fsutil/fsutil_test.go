@@ -0,0 +1,54 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"old", "new"} {
+		if err := WriteFileAtomic(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFileAtomic: %v", err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != content {
+			t.Errorf("content = %q (%v), want %q", got, err, content)
+		}
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only state.json", len(entries))
+	}
+}
+
+func TestWriteBackupKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	if err := WriteBackup(path, []byte("first"), 0); err != nil {
+		t.Fatalf("WriteBackup: %v", err)
+	}
+	if err := WriteBackup(path, []byte("second"), 0); err != nil {
+		t.Fatalf("WriteBackup again: %v", err)
+	}
+	if err := WriteBackup(path, []byte("v1"), 1); err != nil {
+		t.Fatalf("WriteBackup v1: %v", err)
+	}
+
+	if got := BackupPath(path, 0); filepath.Base(got) != "config.json.v0.bak" {
+		t.Errorf("BackupPath = %s, want config.json.v0.bak", got)
+	}
+	if got, err := os.ReadFile(BackupPath(path, 0)); err != nil || string(got) != "first" {
+		t.Errorf("v0 backup = %q (%v), want the first copy", got, err)
+	}
+	if got, err := os.ReadFile(BackupPath(path, 1)); err != nil || string(got) != "v1" {
+		t.Errorf("v1 backup = %q (%v), want %q", got, err, "v1")
+	}
+}
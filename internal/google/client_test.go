@@ -0,0 +1,59 @@
+package google_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/google"
+	"github.com/davidaniva/immich-importer/internal/google/drivetest"
+)
+
+func newClient(t *testing.T, srv *drivetest.Server, accessToken string, expiry time.Time) *google.Client {
+	t.Helper()
+	c, err := google.NewClientWithEndpoints(srv.Endpoints(), drivetest.OAuth, accessToken, drivetest.RefreshToken, expiry)
+	if err != nil {
+		t.Fatalf("NewClientWithEndpoints: %v", err)
+	}
+	return c
+}
+
+func TestListTakeoutFilesPaging(t *testing.T) {
+	srv := drivetest.NewServer(t)
+	srv.PageSize = 2
+	for _, name := range []string{"takeout-001.zip", "takeout-002.zip", "notes.zip", "takeout-003.zip", "takeout-004.zip", "takeout-005.zip"} {
+		srv.AddFile(name, "application/zip", []byte(name))
+	}
+	srv.AddFile("takeout-folder", "application/vnd.google-apps.folder", nil)
+
+	files, err := newClient(t, srv, drivetest.AccessToken, time.Now().Add(time.Hour)).ListTakeoutFiles()
+	if err != nil {
+		t.Fatalf("ListTakeoutFiles: %v", err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("got %d files, want the 5 takeout zips across 3 pages: %+v", len(files), files)
+	}
+	if files[4].Name != "takeout-005.zip" || files[4].Size != int64(len("takeout-005.zip")) {
+		t.Errorf("last file = %+v", files[4])
+	}
+}
+
+func TestExpiredTokenIsRefreshed(t *testing.T) {
+	srv := drivetest.NewServer(t)
+	id := srv.AddFile("takeout-001.zip", "application/zip", []byte("zip content"))
+
+	c := newClient(t, srv, "expired-token", time.Now().Add(-time.Hour))
+	resp, err := c.DownloadFileRange(context.Background(), id, 4)
+	if err != nil {
+		t.Fatalf("DownloadFileRange: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 206 || string(body) != "content" {
+		t.Fatalf("got %d %q, want 206 %q", resp.StatusCode, body, "content")
+	}
+	if srv.Refreshes() != 1 {
+		t.Errorf("got %d token refreshes, want 1", srv.Refreshes())
+	}
+}
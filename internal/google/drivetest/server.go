@@ -0,0 +1,338 @@
+// Package drivetest provides an in-process fake of the Google Drive API and
+// OAuth token endpoint for tests. It serves file listings with paging,
+// downloads with Range support, and can throttle requests or drop downloads
+// halfway through.
+package drivetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davidaniva/immich-importer/internal/config"
+	"github.com/davidaniva/immich-importer/internal/google"
+	"golang.org/x/oauth2"
+)
+
+// Tokens the server accepts. AccessToken is valid from the start; the refresh
+// token is exchanged for new access tokens.
+const (
+	AccessToken  = "drivetest-access-token"
+	RefreshToken = "drivetest-refresh-token"
+)
+
+// OAuth is the client configuration the token endpoint accepts
+var OAuth = config.OAuthConfig{ClientID: "drivetest-client", ClientSecret: "drivetest-secret"}
+
+// File is a file in the fake Drive
+type File struct {
+	ID       string
+	Name     string
+	MimeType string
+	Content  []byte
+}
+
+// Server is a fake Google Drive
+type Server struct {
+	*httptest.Server
+
+	// PageSize caps the files per listing page, whatever the client asks for
+	PageSize int
+
+	mu          sync.Mutex
+	files       []*File
+	tokens      map[string]bool
+	refreshes   int
+	throttle    int
+	disconnect  map[string]int64
+	ignoreRange bool
+	ranges      map[string][]int64
+}
+
+// NewServer starts a fake Drive that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		PageSize:   100,
+		tokens:     map[string]bool{AccessToken: true},
+		disconnect: make(map[string]int64),
+		ranges:     make(map[string][]int64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /drive/v3/files", s.auth(s.list))
+	mux.HandleFunc("GET /drive/v3/files/{id}", s.auth(s.download))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Endpoints returns endpoints that point at the server
+func (s *Server) Endpoints() google.Endpoints {
+	return google.Endpoints{
+		DriveAPI: s.URL + "/drive/v3",
+		OAuth: oauth2.Endpoint{
+			AuthURL:   s.URL + "/auth",
+			TokenURL:  s.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// AddFile adds a file and returns its ID
+func (s *Server) AddFile(name, mimeType string, content []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := &File{ID: fmt.Sprintf("file-%03d", len(s.files)+1), Name: name, MimeType: mimeType, Content: content}
+	s.files = append(s.files, f)
+	return f.ID
+}
+
+// Throttle makes the next n Drive requests fail with 429 Too Many Requests
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttle = n
+}
+
+// DisconnectAfter makes the next download of a file drop the connection after
+// sending n bytes of the file
+func (s *Server) DisconnectAfter(id string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect[id] = n
+}
+
+// IgnoreRange makes downloads send the whole file whatever Range asks for
+func (s *Server) IgnoreRange(ignore bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignoreRange = ignore
+}
+
+// Ranges returns the start offsets of the downloads of a file, in order
+func (s *Server) Ranges(id string) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.ranges[id]...)
+}
+
+// Refreshes returns how often an access token was refreshed
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// writeError answers like the Google APIs do
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("client_id") != OAuth.ClientID || r.FormValue("client_secret") != OAuth.ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != RefreshToken {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.refreshes++
+	token := fmt.Sprintf("drivetest-refreshed-%d", s.refreshes)
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		valid := s.tokens[token]
+		throttled := s.throttle > 0
+		if throttled {
+			s.throttle--
+		}
+		s.mu.Unlock()
+
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "authError", "Invalid Credentials")
+			return
+		}
+		if throttled {
+			w.Header().Set("Retry-After", "0")
+			writeError(w, http.StatusTooManyRequests, "rateLimitExceeded", "Rate Limit Exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// list supports the queries the importer sends: name contains '...' and
+// mimeType = '...', joined by "and"
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize := s.PageSize
+	if n, err := strconv.Atoi(query.Get("pageSize")); err == nil && n < pageSize {
+		pageSize = n
+	}
+	offset := 0
+	if token := query.Get("pageToken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid page token")
+			return
+		}
+		offset = n
+	}
+
+	s.mu.Lock()
+	var matches []*File
+	for _, f := range s.files {
+		if matchesQuery(f, query.Get("q")) {
+			matches = append(matches, f)
+		}
+	}
+	s.mu.Unlock()
+
+	type driveFile struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Size     string `json:"size"`
+		MimeType string `json:"mimeType"`
+	}
+	resp := struct {
+		Files         []driveFile `json:"files"`
+		NextPageToken string      `json:"nextPageToken,omitempty"`
+	}{Files: []driveFile{}}
+
+	end := min(offset+pageSize, len(matches))
+	for _, f := range matches[min(offset, end):end] {
+		resp.Files = append(resp.Files, driveFile{ID: f.ID, Name: f.Name, Size: strconv.Itoa(len(f.Content)), MimeType: f.MimeType})
+	}
+	// Like Drive, only send the page token if the fields ask for it
+	fields := query.Get("fields")
+	if end < len(matches) && (fields == "" || strings.Contains(fields, "nextPageToken")) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func matchesQuery(f *File, q string) bool {
+	for _, clause := range strings.Split(q, " and ") {
+		clause = strings.TrimSpace(clause)
+		switch {
+		case clause == "":
+		case strings.HasPrefix(clause, "name contains "):
+			want := strings.Trim(strings.TrimPrefix(clause, "name contains "), "'")
+			if !strings.Contains(strings.ToLower(f.Name), strings.ToLower(want)) {
+				return false
+			}
+		case strings.HasPrefix(clause, "mimeType = "):
+			if f.MimeType != strings.Trim(strings.TrimPrefix(clause, "mimeType = "), "'") {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("alt") != "media" {
+		writeError(w, http.StatusBadRequest, "badRequest", "Only alt=media is supported")
+		return
+	}
+
+	s.mu.Lock()
+	var file *File
+	for _, f := range s.files {
+		if f.ID == r.PathValue("id") {
+			file = f
+		}
+	}
+	cutAt, cut := int64(-1), false
+	if file != nil {
+		cutAt, cut = s.disconnect[file.ID]
+		delete(s.disconnect, file.ID)
+	}
+	ignoreRange := s.ignoreRange
+	s.mu.Unlock()
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "notFound", "File not found")
+		return
+	}
+
+	size := int64(len(file.Content))
+	start := int64(0)
+	if header := r.Header.Get("Range"); header != "" && !ignoreRange {
+		n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(header, "bytes="), "-"), 10, 64)
+		if err != nil || !strings.HasSuffix(header, "-") {
+			writeError(w, http.StatusBadRequest, "badRequest", "Unsupported Range")
+			return
+		}
+		if n >= size {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		start = n
+	}
+
+	s.mu.Lock()
+	s.ranges[file.ID] = append(s.ranges[file.ID], start)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", file.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size-start, 10))
+	if start > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	body := file.Content[start:]
+	if !cut || cutAt >= size {
+		w.Write(body)
+		return
+	}
+
+	// Send the bytes up to the cut, then drop the connection
+	if cutAt > start {
+		w.Write(body[:cutAt-start])
+	}
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
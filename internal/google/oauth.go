@@ -14,8 +14,22 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
+// Endpoints are the Google URLs a client talks to. Tests point them at fakes.
+type Endpoints struct {
+	// DriveAPI is the base URL of the Drive v3 API
+	DriveAPI string
+	OAuth    oauth2.Endpoint
+}
+
+// DefaultEndpoints are Google's production endpoints
+var DefaultEndpoints = Endpoints{
+	DriveAPI: "https://www.googleapis.com/drive/v3",
+	OAuth:    google.Endpoint,
+}
+
 // Client handles Google API interactions
 type Client struct {
+	endpoints    Endpoints
 	oauth2Config *oauth2.Config
 	token        *oauth2.Token
 	httpClient   *http.Client
@@ -59,6 +73,11 @@ const oauthCallbackPort = 8085
 
 // StartOAuth initiates the OAuth flow and returns the auth URL
 func StartOAuth(cfg config.OAuthConfig) (*Client, string, error) {
+	return StartOAuthWithEndpoints(DefaultEndpoints, cfg)
+}
+
+// StartOAuthWithEndpoints is StartOAuth against the given endpoints
+func StartOAuthWithEndpoints(endpoints Endpoints, cfg config.OAuthConfig) (*Client, string, error) {
 	// Use fixed port so redirect URI can be registered in Google Cloud Console
 	// Listen on 127.0.0.1 but use "localhost" in redirect URI (Google treats them differently)
 	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", oauthCallbackPort))
@@ -72,10 +91,11 @@ func StartOAuth(cfg config.OAuthConfig) (*Client, string, error) {
 		ClientSecret: cfg.ClientSecret,
 		RedirectURL:  redirectURI,
 		Scopes:       scopes,
-		Endpoint:     google.Endpoint,
+		Endpoint:     endpoints.OAuth,
 	}
 
 	client := &Client{
+		endpoints:    endpoints,
 		oauth2Config: oauth2Config,
 		callbackChan: make(chan string, 1),
 		listener:     listener,
@@ -172,11 +192,16 @@ func (c *Client) GetTokens() Tokens {
 
 // NewClientFromTokens creates a client from stored tokens
 func NewClientFromTokens(cfg config.OAuthConfig, accessToken, refreshToken string, expiry time.Time) (*Client, error) {
+	return NewClientWithEndpoints(DefaultEndpoints, cfg, accessToken, refreshToken, expiry)
+}
+
+// NewClientWithEndpoints is NewClientFromTokens against the given endpoints
+func NewClientWithEndpoints(endpoints Endpoints, cfg config.OAuthConfig, accessToken, refreshToken string, expiry time.Time) (*Client, error) {
 	oauth2Config := &oauth2.Config{
 		ClientID:     cfg.ClientID,
 		ClientSecret: cfg.ClientSecret,
 		Scopes:       scopes,
-		Endpoint:     google.Endpoint,
+		Endpoint:     endpoints.OAuth,
 	}
 
 	token := &oauth2.Token{
@@ -187,6 +212,7 @@ func NewClientFromTokens(cfg config.OAuthConfig, accessToken, refreshToken strin
 
 	ctx := context.Background()
 	client := &Client{
+		endpoints:    endpoints,
 		oauth2Config: oauth2Config,
 		token:        token,
 		httpClient:   oauth2Config.Client(ctx, token),
@@ -205,8 +231,8 @@ func (c *Client) ListTakeoutFiles() ([]DriveFile, error) {
 
 	for {
 		apiURL := fmt.Sprintf(
-			"https://www.googleapis.com/drive/v3/files?q=%s&fields=files(id,name,size,mimeType)&pageSize=100",
-			url.QueryEscape(query),
+			"%s/files?q=%s&fields=nextPageToken,files(id,name,size,mimeType)&pageSize=100",
+			c.endpoints.DriveAPI, url.QueryEscape(query),
 		)
 		if pageToken != "" {
 			apiURL += "&pageToken=" + url.QueryEscape(pageToken)
@@ -245,13 +271,13 @@ func (c *Client) ListTakeoutFiles() ([]DriveFile, error) {
 
 // DownloadFile downloads a file from Google Drive
 func (c *Client) DownloadFile(fileID string) (*http.Response, error) {
-	url := fmt.Sprintf("https://www.googleapis.com/drive/v3/files/%s?alt=media", fileID)
-	return c.httpClient.Get(url)
+	apiURL := fmt.Sprintf("%s/files/%s?alt=media", c.endpoints.DriveAPI, url.PathEscape(fileID))
+	return c.httpClient.Get(apiURL)
 }
 
 // DownloadFileRange downloads a file with Range header for resume
 func (c *Client) DownloadFileRange(ctx context.Context, fileID string, startByte int64) (*http.Response, error) {
-	apiURL := fmt.Sprintf("https://www.googleapis.com/drive/v3/files/%s?alt=media", fileID)
+	apiURL := fmt.Sprintf("%s/files/%s?alt=media", c.endpoints.DriveAPI, url.PathEscape(fileID))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
@@ -0,0 +1,48 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+// Album is an Immich album
+type Album struct {
+	ID        string `json:"id"`
+	AlbumName string `json:"albumName"`
+}
+
+// ListAlbums returns the albums of the API key's user
+func (c *Client) ListAlbums(ctx context.Context) ([]Album, error) {
+	var albums []Album
+	if err := c.do(ctx, "GET", "/api/albums", nil, &albums); err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", err)
+	}
+	return albums, nil
+}
+
+// CreateAlbum creates an empty album
+func (c *Client) CreateAlbum(ctx context.Context, name string) (*Album, error) {
+	var album Album
+	if err := c.do(ctx, "POST", "/api/albums", map[string]interface{}{"albumName": name}, &album); err != nil {
+		return nil, fmt.Errorf("failed to create album %q: %w", name, err)
+	}
+	return &album, nil
+}
+
+// AddAssetsToAlbum adds assets to an album. Assets already in it are reported
+// with BulkErrorDuplicate.
+func (c *Client) AddAssetsToAlbum(ctx context.Context, albumID string, assetIDs []string) ([]BulkIDResult, error) {
+	var results []BulkIDResult
+	if err := c.do(ctx, "PUT", "/api/albums/"+albumID+"/assets", map[string]interface{}{"ids": assetIDs}, &results); err != nil {
+		return nil, fmt.Errorf("failed to add assets to album: %w", err)
+	}
+	return results, nil
+}
+
+// DeleteAlbum deletes an album. Its assets are kept.
+func (c *Client) DeleteAlbum(ctx context.Context, albumID string) error {
+	if err := c.do(ctx, "DELETE", "/api/albums/"+albumID, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete album: %w", err)
+	}
+	return nil
+}
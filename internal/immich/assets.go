@@ -0,0 +1,185 @@
+package immich
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upload statuses
+const (
+	UploadCreated   = "created"
+	UploadDuplicate = "duplicate"
+	UploadReplaced  = "replaced"
+)
+
+// UploadRequest is a single asset upload
+type UploadRequest struct {
+	Filename string
+	Content  []byte
+
+	// DeviceAssetID and DeviceID identify the asset on the uploading device
+	DeviceAssetID string
+	DeviceID      string
+
+	FileCreatedAt  time.Time
+	FileModifiedAt time.Time
+
+	// Optional fields
+	Sidecar          []byte // XMP sidecar
+	LivePhotoVideoID string
+	Visibility       string // "", "archive", "hidden" or "locked"
+	IsFavorite       bool
+}
+
+// UploadResult is the server's answer to an upload
+type UploadResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // UploadCreated, UploadDuplicate or UploadReplaced
+}
+
+// Upload uploads an asset. Content the server already has is not an error; the
+// result then has UploadDuplicate status and the existing asset's ID.
+func (c *Client) Upload(ctx context.Context, r *UploadRequest) (*UploadResult, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	part, err := writer.CreateFormFile("assetData", r.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(r.Content); err != nil {
+		return nil, err
+	}
+
+	writer.WriteField("deviceAssetId", r.DeviceAssetID)
+	writer.WriteField("deviceId", r.DeviceID)
+	writer.WriteField("fileCreatedAt", r.FileCreatedAt.Format(time.RFC3339))
+	writer.WriteField("fileModifiedAt", r.FileModifiedAt.Format(time.RFC3339))
+	if r.LivePhotoVideoID != "" {
+		writer.WriteField("livePhotoVideoId", r.LivePhotoVideoID)
+	}
+	if r.Visibility != "" {
+		writer.WriteField("visibility", r.Visibility)
+	}
+	if r.IsFavorite {
+		writer.WriteField("isFavorite", strconv.FormatBool(r.IsFavorite))
+	}
+
+	if r.Sidecar != nil {
+		part, err := writer.CreateFormFile("sidecarData", r.Filename+".xmp")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(r.Sidecar); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, "POST", "/api/assets", &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var result UploadResult
+	code, err := c.send(req, &result)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("upload response has no asset ID")
+	}
+
+	// Immich answers 200 for content it already has, 201 for new assets
+	switch result.Status {
+	case UploadCreated, UploadDuplicate, UploadReplaced:
+	case "":
+		result.Status = UploadCreated
+		if code == http.StatusOK {
+			result.Status = UploadDuplicate
+		}
+	default:
+		return nil, fmt.Errorf("unexpected upload status %q", result.Status)
+	}
+
+	return &result, nil
+}
+
+// BulkCheckItem is a file to check before uploading it
+type BulkCheckItem struct {
+	ID       string `json:"id"`       // chosen by the caller, returned in the result
+	Checksum string `json:"checksum"` // SHA-1 of the content, hex or base64
+}
+
+// BulkCheckResult says whether the server wants a file
+type BulkCheckResult struct {
+	ID        string `json:"id"`
+	Action    string `json:"action"`           // "accept" or "reject"
+	Reason    string `json:"reason,omitempty"` // "duplicate" or "unsupported-format"
+	AssetID   string `json:"assetId,omitempty"`
+	IsTrashed bool   `json:"isTrashed,omitempty"`
+}
+
+// BulkUploadCheck asks which files the server already has
+func (c *Client) BulkUploadCheck(ctx context.Context, items []BulkCheckItem) ([]BulkCheckResult, error) {
+	var resp struct {
+		Results []BulkCheckResult `json:"results"`
+	}
+	if err := c.do(ctx, "POST", "/api/assets/bulk-upload-check", map[string]interface{}{"assets": items}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to check assets: %w", err)
+	}
+	return resp.Results, nil
+}
+
+// AssetUpdate changes assets. Nil fields are left as they are.
+type AssetUpdate struct {
+	IDs              []string `json:"ids"`
+	IsFavorite       *bool    `json:"isFavorite,omitempty"`
+	Visibility       *string  `json:"visibility,omitempty"`
+	DateTimeOriginal *string  `json:"dateTimeOriginal,omitempty"`
+	Latitude         *float64 `json:"latitude,omitempty"`
+	Longitude        *float64 `json:"longitude,omitempty"`
+	Description      *string  `json:"description,omitempty"`
+}
+
+// UpdateAssets changes several assets at once
+func (c *Client) UpdateAssets(ctx context.Context, update AssetUpdate) error {
+	if err := c.do(ctx, "PUT", "/api/assets", update, nil); err != nil {
+		return fmt.Errorf("failed to update assets: %w", err)
+	}
+	return nil
+}
+
+// AssetInfo is an asset as the server describes it
+type AssetInfo struct {
+	ID        string `json:"id"`
+	OwnerID   string `json:"ownerId"`
+	IsTrashed bool   `json:"isTrashed"`
+}
+
+// GetAsset returns an asset, trashed or not
+func (c *Client) GetAsset(ctx context.Context, id string) (*AssetInfo, error) {
+	var asset AssetInfo
+	if err := c.do(ctx, "GET", "/api/assets/"+id, nil, &asset); err != nil {
+		return nil, fmt.Errorf("failed to read asset: %w", err)
+	}
+	return &asset, nil
+}
+
+// DeleteAssets moves assets to the trash, or deletes them for good if force
+// is set
+func (c *Client) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	if err := c.do(ctx, "DELETE", "/api/assets", map[string]interface{}{"ids": ids, "force": force}, nil); err != nil {
+		return fmt.Errorf("failed to delete assets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Package immich is a client for the parts of the Immich API the importer uses
+package immich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Client calls the API of one Immich server with one API key
+type Client struct {
+	baseURL string
+	apiKey  string
+
+	// HTTPClient sends the requests. New sets a long timeout for uploads.
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL, the URL "/api/..." paths
+// are appended to. The API key may be empty for unauthenticated endpoints.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		HTTPClient: &http.Client{
+			Timeout: 5 * time.Minute, // Long timeout for uploads
+		},
+	}
+}
+
+// BaseURL returns the server URL the client was created with
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Error is a non-2xx response from the API
+type Error struct {
+	StatusCode int
+	// Message is Immich's error message, if the body had one
+	Message string
+	Body    string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// StatusCode returns the HTTP status of an API error, or 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsUnauthorized reports whether the server rejected the API key
+func IsUnauthorized(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// IsNotFound reports whether the server does not know the requested item.
+// Immich answers 400 rather than 404 for IDs that do not exist.
+func IsNotFound(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusNotFound || code == http.StatusBadRequest
+}
+
+// decodeError reads an error response. Immich sends
+// {"message": "...", "error": "...", "statusCode": 400}; message may also be
+// a list of validation errors.
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	apiErr := &Error{StatusCode: resp.StatusCode, Body: string(data)}
+
+	var body struct {
+		Message json.RawMessage `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil && len(body.Message) > 0 {
+		var message string
+		var messages []string
+		if json.Unmarshal(body.Message, &message) == nil {
+			apiErr.Message = message
+		} else if json.Unmarshal(body.Message, &messages) == nil {
+			apiErr.Message = fmt.Sprint(messages)
+		}
+	}
+	return apiErr
+}
+
+// newRequest creates a request with the auth and accept headers set
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("x-api-key", c.apiKey)
+	}
+	return req, nil
+}
+
+// send sends a request and decodes a JSON response into out, if not nil.
+// It returns the HTTP status of successful responses.
+func (c *Client) send(req *http.Request, out interface{}) (int, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, decodeError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("failed to parse response from %s: %w", req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	_, err = c.send(req, out)
+	return err
+}
+
+// BulkIDResult is the outcome for one ID of a bulk request
+type BulkIDResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"` // e.g. "duplicate", "not_found"
+}
+
+// Error reported for assets that already are in the album or have the tag
+const BulkErrorDuplicate = "duplicate"
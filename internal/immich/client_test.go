@@ -0,0 +1,205 @@
+package immich_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/immich/immichtest"
+)
+
+func upload(t *testing.T, c *immich.Client, name, content string) *immich.UploadResult {
+	t.Helper()
+	taken := time.Date(2019, 3, 12, 10, 11, 12, 0, time.UTC)
+	result, err := c.Upload(context.Background(), &immich.UploadRequest{
+		Filename:       name,
+		Content:        []byte(content),
+		DeviceAssetID:  "asset-" + name,
+		DeviceID:       "test",
+		FileCreatedAt:  taken,
+		FileModifiedAt: taken,
+		Sidecar:        []byte("<x:xmpmeta/>"),
+		IsFavorite:     true,
+	})
+	if err != nil {
+		t.Fatalf("Upload(%s): %v", name, err)
+	}
+	return result
+}
+
+func TestServerInfo(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	c := srv.Client()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	v, err := c.Version(ctx)
+	if err != nil || v != srv.Version {
+		t.Fatalf("Version = %v, %v; want %v", v, err, srv.Version)
+	}
+	types, err := c.MediaTypes(ctx)
+	if err != nil || len(types.Image) == 0 {
+		t.Fatalf("MediaTypes = %v, %v", types, err)
+	}
+	perms, err := c.APIKeyPermissions(ctx)
+	if err != nil || len(perms) != 1 || perms[0] != "all" {
+		t.Fatalf("APIKeyPermissions = %v, %v", perms, err)
+	}
+
+	srv.Permissions = nil
+	if _, err := c.APIKeyPermissions(ctx); immich.StatusCode(err) != 404 {
+		t.Fatalf("APIKeyPermissions on old server: got %v, want 404", err)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	c := immich.New(srv.URL, "wrong-key")
+
+	_, err := c.CurrentUser(context.Background())
+	if !immich.IsUnauthorized(err) {
+		t.Fatalf("CurrentUser with wrong key: got %v, want unauthorized", err)
+	}
+	var apiErr *immich.Error
+	if !errors.As(err, &apiErr) || apiErr.Message != "Invalid API key" {
+		t.Fatalf("error message not decoded: %#v", err)
+	}
+}
+
+func TestUploadAndDuplicates(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	c := srv.Client()
+
+	first := upload(t, c, "a.jpg", "content a")
+	if first.Status != immich.UploadCreated {
+		t.Errorf("first upload status = %q, want created", first.Status)
+	}
+	again := upload(t, c, "copy.jpg", "content a")
+	if again.Status != immich.UploadDuplicate || again.ID != first.ID {
+		t.Errorf("second upload = %+v, want duplicate of %s", again, first.ID)
+	}
+
+	asset, ok := srv.Asset(first.ID)
+	if !ok {
+		t.Fatal("asset not stored")
+	}
+	if !asset.IsFavorite || asset.DeviceID != "test" || string(asset.Sidecar) != "<x:xmpmeta/>" {
+		t.Errorf("stored asset = %+v", asset)
+	}
+	if !asset.FileCreatedAt.Equal(time.Date(2019, 3, 12, 10, 11, 12, 0, time.UTC)) {
+		t.Errorf("FileCreatedAt = %v", asset.FileCreatedAt)
+	}
+
+	results, err := c.BulkUploadCheck(context.Background(), []immich.BulkCheckItem{
+		{ID: "1", Checksum: asset.Checksum},
+		{ID: "2", Checksum: "0000000000000000000000000000000000000000"},
+	})
+	if err != nil {
+		t.Fatalf("BulkUploadCheck: %v", err)
+	}
+	if results[0].Action != "reject" || results[0].AssetID != first.ID || results[1].Action != "accept" {
+		t.Errorf("BulkUploadCheck = %+v", results)
+	}
+
+	srv.FailUploads(1)
+	if _, err := c.Upload(context.Background(), &immich.UploadRequest{Filename: "b.jpg", Content: []byte("b"), DeviceAssetID: "b", DeviceID: "test"}); immich.StatusCode(err) != 500 {
+		t.Errorf("failing upload: got %v, want 500", err)
+	}
+}
+
+func TestAlbumsTagsStacks(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	c := srv.Client()
+	ctx := context.Background()
+
+	a := upload(t, c, "a.jpg", "a").ID
+	b := upload(t, c, "b.jpg", "b").ID
+
+	album, err := c.CreateAlbum(ctx, "Holidays")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, err := c.AddAssetsToAlbum(ctx, album.ID, []string{a}); err != nil {
+		t.Fatalf("AddAssetsToAlbum: %v", err)
+	}
+	results, err := c.AddAssetsToAlbum(ctx, album.ID, []string{a, b})
+	if err != nil {
+		t.Fatalf("AddAssetsToAlbum: %v", err)
+	}
+	if results[0].Error != immich.BulkErrorDuplicate || !results[1].Success {
+		t.Errorf("AddAssetsToAlbum = %+v", results)
+	}
+	albums, err := c.ListAlbums(ctx)
+	if err != nil || len(albums) != 1 || albums[0].AlbumName != "Holidays" {
+		t.Fatalf("ListAlbums = %v, %v", albums, err)
+	}
+
+	tags, err := c.UpsertTags(ctx, []string{"People/Alice"})
+	if err != nil || len(tags) != 1 || tags[0].Value != "People/Alice" {
+		t.Fatalf("UpsertTags = %v, %v", tags, err)
+	}
+	again, _ := c.UpsertTags(ctx, []string{"People/Alice"})
+	if again[0].ID != tags[0].ID {
+		t.Errorf("UpsertTags created a second tag")
+	}
+	if _, err := c.TagAssets(ctx, tags[0].ID, []string{a}); err != nil {
+		t.Fatalf("TagAssets: %v", err)
+	}
+	if got := len(srv.Tags()); got != 2 {
+		t.Errorf("got %d tags, want People and People/Alice", got)
+	}
+
+	stack, err := c.CreateStack(ctx, []string{b, a})
+	if err != nil || stack.PrimaryAssetID != b {
+		t.Fatalf("CreateStack = %+v, %v", stack, err)
+	}
+
+	favorite := false
+	if err := c.UpdateAssets(ctx, immich.AssetUpdate{IDs: []string{a}, IsFavorite: &favorite}); err != nil {
+		t.Fatalf("UpdateAssets: %v", err)
+	}
+	if asset, _ := srv.Asset(a); asset.IsFavorite {
+		t.Error("UpdateAssets did not clear favorite")
+	}
+
+	if err := c.DeleteAssets(ctx, []string{a}, false); err != nil {
+		t.Fatalf("DeleteAssets: %v", err)
+	}
+	if asset, _ := srv.Asset(a); !asset.IsTrashed {
+		t.Error("asset not trashed")
+	}
+	if err := c.DeleteAssets(ctx, []string{a, b}, true); err != nil {
+		t.Fatalf("DeleteAssets(force): %v", err)
+	}
+	if err := c.DeleteAssets(ctx, []string{a}, true); !immich.IsNotFound(err) {
+		t.Errorf("deleting a deleted asset: got %v, want not found", err)
+	}
+	if err := c.DeleteAlbum(ctx, album.ID); err != nil {
+		t.Fatalf("DeleteAlbum: %v", err)
+	}
+}
+
+func TestSetupTokens(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	ctx := context.Background()
+
+	token, err := srv.Client().CreateSetupToken(ctx)
+	if err != nil {
+		t.Fatalf("CreateSetupToken: %v", err)
+	}
+	cfg, err := immich.New(srv.URL, "").ImporterConfig(ctx, token)
+	if err != nil {
+		t.Fatalf("ImporterConfig: %v", err)
+	}
+	if cfg.APIKey != srv.APIKey || cfg.ServerURL != srv.URL || cfg.OAuth.ClientID == "" {
+		t.Errorf("ImporterConfig = %+v", cfg)
+	}
+
+	if _, err := immich.New(srv.URL, "").ImporterConfig(ctx, "unknown"); immich.StatusCode(err) != 404 {
+		t.Errorf("unknown token: got %v, want 404", err)
+	}
+}
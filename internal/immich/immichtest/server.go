@@ -0,0 +1,775 @@
+// Package immichtest provides an in-process fake Immich server for tests. It
+// implements the endpoints the importer uses and keeps what was uploaded in
+// memory, so tests can inspect assets, albums, tags and stacks.
+package immichtest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+)
+
+// APIKey is the key the server accepts unless Server.APIKey is changed
+const APIKey = "immichtest-api-key"
+
+// Asset is an uploaded asset
+type Asset struct {
+	ID            string
+	OwnerID       string
+	DeviceAssetID string
+	DeviceID      string
+	Filename      string
+	Checksum      string // hex SHA-1 of the content
+	Size          int
+
+	FileCreatedAt    time.Time
+	FileModifiedAt   time.Time
+	Sidecar          []byte
+	LivePhotoVideoID string
+	Visibility       string
+	IsFavorite       bool
+	IsTrashed        bool
+	StackID          string
+	TagIDs           []string
+}
+
+// Album is an album and the IDs of its assets, in the order they were added
+type Album struct {
+	ID       string
+	Name     string
+	AssetIDs []string
+}
+
+// Tag is a tag; Value is the full path, e.g. "People/Alice"
+type Tag struct {
+	ID       string
+	Value    string
+	ParentID string
+}
+
+// Server is a fake Immich server
+type Server struct {
+	*httptest.Server
+
+	// Settings, safe to change before the first request
+	APIKey      string
+	Version     immich.Version
+	MediaTypes  immich.MediaTypes
+	Permissions []string // nil makes /api/api-keys/me answer 404, like old servers
+	OAuth       struct{ ClientID, ClientSecret string }
+
+	// OnUpload, if set, is called with the number of upload requests so far
+	// as each one arrives, before it is answered. Tests use it to interrupt
+	// an import partway.
+	OnUpload func(uploads int)
+
+	mu          sync.Mutex
+	nextID      int
+	assets      map[string]*Asset
+	albums      map[string]*Album
+	tags        map[string]*Tag
+	stacks      map[string][]string
+	setupTokens map[string]bool
+	userID      string
+	failUploads int
+	failDeletes int
+	failStacks  int
+	uploads     int
+}
+
+// NewServer starts a fake server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		APIKey:      APIKey,
+		Version:     immich.Version{Major: 1, Minor: 133, Patch: 0},
+		Permissions: []string{"all"},
+		MediaTypes: immich.MediaTypes{
+			Image:   []string{".jpg", ".jpeg", ".png", ".gif", ".heic", ".heif", ".webp", ".dng", ".cr2", ".nef", ".arw", ".tif", ".tiff"},
+			Video:   []string{".mp4", ".mov", ".m4v", ".3gp", ".avi", ".mkv", ".webm"},
+			Sidecar: []string{".xmp"},
+		},
+		userID:      "user-1",
+		assets:      make(map[string]*Asset),
+		albums:      make(map[string]*Album),
+		tags:        make(map[string]*Tag),
+		stacks:      make(map[string][]string),
+		setupTokens: make(map[string]bool),
+	}
+	s.OAuth.ClientID = "immichtest-client-id"
+	s.OAuth.ClientSecret = "immichtest-client-secret"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/immich", s.wellKnown)
+	mux.HandleFunc("GET /api/server/ping", s.ping)
+	mux.HandleFunc("GET /api/server/version", s.version)
+	mux.HandleFunc("GET /api/server/media-types", s.mediaTypes)
+	mux.HandleFunc("GET /api/api-keys/me", s.auth(s.apiKeyMe))
+	mux.HandleFunc("GET /api/users/me", s.auth(s.userMe))
+	mux.HandleFunc("POST /api/assets", s.auth(s.upload))
+	mux.HandleFunc("PUT /api/assets", s.auth(s.updateAssets))
+	mux.HandleFunc("GET /api/assets/{id}", s.auth(s.getAsset))
+	mux.HandleFunc("DELETE /api/assets", s.auth(s.deleteAssets))
+	mux.HandleFunc("POST /api/assets/bulk-upload-check", s.auth(s.bulkUploadCheck))
+	mux.HandleFunc("GET /api/albums", s.auth(s.listAlbums))
+	mux.HandleFunc("POST /api/albums", s.auth(s.createAlbum))
+	mux.HandleFunc("PUT /api/albums/{id}/assets", s.auth(s.addToAlbum))
+	mux.HandleFunc("DELETE /api/albums/{id}", s.auth(s.deleteAlbum))
+	mux.HandleFunc("PUT /api/tags", s.auth(s.upsertTags))
+	mux.HandleFunc("DELETE /api/tags/{id}", s.auth(s.deleteTag))
+	mux.HandleFunc("PUT /api/tags/{id}/assets", s.auth(s.tagAssets))
+	mux.HandleFunc("POST /api/stacks", s.auth(s.createStack))
+	mux.HandleFunc("POST /api/importer/setup-token", s.auth(s.createSetupToken))
+	mux.HandleFunc("GET /api/importer/config/{token}", s.importerConfig)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client for the server with its API key
+func (s *Server) Client() *immich.Client {
+	return immich.New(s.URL, s.APIKey)
+}
+
+// SetUser makes the API key belong to another user, who cannot see the assets
+// of the previous one
+func (s *Server) SetUser(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userID = id
+}
+
+// FailUploads makes the next n uploads fail with a server error
+func (s *Server) FailUploads(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failUploads = n
+}
+
+// FailDeletes makes the next n asset delete requests fail with a server error
+func (s *Server) FailDeletes(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failDeletes = n
+}
+
+// FailStacks makes the next n stack requests fail with a server error
+func (s *Server) FailStacks(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failStacks = n
+}
+
+// Uploads returns the number of upload requests received, including
+// duplicates and failures
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads
+}
+
+// Assets returns copies of all assets, trashed ones included, by file name
+func (s *Server) Assets() []Asset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assets := make([]Asset, 0, len(s.assets))
+	for _, a := range s.assets {
+		assets = append(assets, *a)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].Filename != assets[j].Filename {
+			return assets[i].Filename < assets[j].Filename
+		}
+		return assets[i].ID < assets[j].ID
+	})
+	return assets
+}
+
+// Asset returns a copy of an asset
+func (s *Server) Asset(id string) (Asset, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.assets[id]
+	if !ok {
+		return Asset{}, false
+	}
+	return *a, true
+}
+
+// AssetByFilename returns a copy of the first asset with the file name
+func (s *Server) AssetByFilename(name string) (Asset, bool) {
+	for _, a := range s.Assets() {
+		if a.Filename == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Albums returns copies of all albums, by name
+func (s *Server) Albums() []Album {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	albums := make([]Album, 0, len(s.albums))
+	for _, a := range s.albums {
+		c := *a
+		c.AssetIDs = append([]string(nil), a.AssetIDs...)
+		albums = append(albums, c)
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].Name < albums[j].Name })
+	return albums
+}
+
+// AddAlbum creates an album, as if the user had made it before the import
+func (s *Server) AddAlbum(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("album")
+	s.albums[id] = &Album{ID: id, Name: name}
+	return id
+}
+
+// Tags returns copies of all tags, by value
+func (s *Server) Tags() []Tag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := make([]Tag, 0, len(s.tags))
+	for _, t := range s.tags {
+		tags = append(tags, *t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Value < tags[j].Value })
+	return tags
+}
+
+// Stacks returns the asset IDs of every stack, primary first, by stack ID
+func (s *Server) Stacks() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stacks := make(map[string][]string, len(s.stacks))
+	for id, ids := range s.stacks {
+		stacks[id] = append([]string(nil), ids...)
+	}
+	return stacks
+}
+
+// AddSetupToken registers a setup token for the server's configuration
+func (s *Server) AddSetupToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setupTokens[token] = true
+}
+
+// newID returns a fresh ID; the caller holds mu
+func (s *Server) newID(kind string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%04d", kind, s.nextID)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers like Immich does
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"message":    message,
+		"error":      http.StatusText(code),
+		"statusCode": code,
+	})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != s.APIKey {
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) wellKnown(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"api": map[string]string{"endpoint": "/api"}})
+}
+
+func (s *Server) ping(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"res": "pong"})
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Version)
+}
+
+func (s *Server) mediaTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.MediaTypes)
+}
+
+func (s *Server) apiKeyMe(w http.ResponseWriter, r *http.Request) {
+	if s.Permissions == nil {
+		writeError(w, http.StatusNotFound, "Cannot GET /api/api-keys/me")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": "key-1", "name": "immichtest", "permissions": s.Permissions})
+}
+
+func (s *Server) userMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, immich.User{ID: s.userID, Email: s.userID + "@example.com", Name: "Test"})
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	file, header, err := r.FormFile("assetData")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "assetData is required")
+		return
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	asset := &Asset{
+		DeviceAssetID:    r.FormValue("deviceAssetId"),
+		DeviceID:         r.FormValue("deviceId"),
+		Filename:         header.Filename,
+		Size:             len(content),
+		LivePhotoVideoID: r.FormValue("livePhotoVideoId"),
+		Visibility:       r.FormValue("visibility"),
+		IsFavorite:       r.FormValue("isFavorite") == "true",
+	}
+	sum := sha1.Sum(content)
+	asset.Checksum = hex.EncodeToString(sum[:])
+
+	if asset.DeviceAssetID == "" || asset.DeviceID == "" {
+		writeError(w, http.StatusBadRequest, "deviceAssetId and deviceId are required")
+		return
+	}
+	if asset.FileCreatedAt, err = time.Parse(time.RFC3339, r.FormValue("fileCreatedAt")); err != nil {
+		writeError(w, http.StatusBadRequest, "fileCreatedAt must be a date string")
+		return
+	}
+	if asset.FileModifiedAt, err = time.Parse(time.RFC3339, r.FormValue("fileModifiedAt")); err != nil {
+		writeError(w, http.StatusBadRequest, "fileModifiedAt must be a date string")
+		return
+	}
+	switch asset.Visibility {
+	case "", "timeline", "archive", "hidden", "locked":
+	default:
+		writeError(w, http.StatusBadRequest, "visibility must be one of: archive, timeline, hidden, locked")
+		return
+	}
+	if sidecar, _, err := r.FormFile("sidecarData"); err == nil {
+		asset.Sidecar, _ = io.ReadAll(sidecar)
+		sidecar.Close()
+	}
+
+	s.mu.Lock()
+	s.uploads++
+	uploads, onUpload := s.uploads, s.OnUpload
+	s.mu.Unlock()
+	if onUpload != nil {
+		onUpload(uploads)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failUploads > 0 {
+		s.failUploads--
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if asset.LivePhotoVideoID != "" && s.assets[asset.LivePhotoVideoID] == nil {
+		writeError(w, http.StatusBadRequest, "Not found or no asset.read access")
+		return
+	}
+
+	for _, existing := range s.assets {
+		if existing.OwnerID == s.userID && existing.Checksum == asset.Checksum {
+			writeJSON(w, http.StatusOK, immich.UploadResult{ID: existing.ID, Status: immich.UploadDuplicate})
+			return
+		}
+	}
+
+	asset.ID = s.newID("asset")
+	asset.OwnerID = s.userID
+	s.assets[asset.ID] = asset
+	writeJSON(w, http.StatusCreated, immich.UploadResult{ID: asset.ID, Status: immich.UploadCreated})
+}
+
+// checkIDs reports an error unless every ID is an asset of the user. Like
+// Immich, it does not tell missing assets from those of other users. The
+// caller holds mu.
+func (s *Server) checkIDs(w http.ResponseWriter, ids []string) bool {
+	for _, id := range ids {
+		if a := s.assets[id]; a == nil || a.OwnerID != s.userID {
+			writeError(w, http.StatusBadRequest, "Not found or no asset access")
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) getAsset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if !s.checkIDs(w, []string{id}) {
+		return
+	}
+	a := s.assets[id]
+	writeJSON(w, http.StatusOK, immich.AssetInfo{ID: a.ID, OwnerID: a.OwnerID, IsTrashed: a.IsTrashed})
+}
+
+func (s *Server) updateAssets(w http.ResponseWriter, r *http.Request) {
+	var update immich.AssetUpdate
+	if !readJSON(w, r, &update) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.checkIDs(w, update.IDs) {
+		return
+	}
+	for _, id := range update.IDs {
+		a := s.assets[id]
+		if update.IsFavorite != nil {
+			a.IsFavorite = *update.IsFavorite
+		}
+		if update.Visibility != nil {
+			a.Visibility = *update.Visibility
+		}
+		if update.DateTimeOriginal != nil {
+			if t, err := time.Parse(time.RFC3339, *update.DateTimeOriginal); err == nil {
+				a.FileCreatedAt = t
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteAssets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs   []string `json:"ids"`
+		Force bool     `json:"force"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failDeletes > 0 {
+		s.failDeletes--
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !s.checkIDs(w, req.IDs) {
+		return
+	}
+	for _, id := range req.IDs {
+		if req.Force {
+			delete(s.assets, id)
+			for _, album := range s.albums {
+				album.AssetIDs = without(album.AssetIDs, id)
+			}
+		} else {
+			s.assets[id].IsTrashed = true
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) bulkUploadCheck(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Assets []immich.BulkCheckItem `json:"assets"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byChecksum := make(map[string]*Asset, len(s.assets))
+	for _, a := range s.assets {
+		if a.OwnerID == s.userID {
+			byChecksum[a.Checksum] = a
+		}
+	}
+
+	results := make([]immich.BulkCheckResult, 0, len(req.Assets))
+	for _, item := range req.Assets {
+		checksum := item.Checksum
+		if raw, err := base64.StdEncoding.DecodeString(checksum); err == nil && len(raw) == sha1.Size {
+			checksum = hex.EncodeToString(raw)
+		}
+		result := immich.BulkCheckResult{ID: item.ID, Action: "accept"}
+		if a, ok := byChecksum[strings.ToLower(checksum)]; ok {
+			result = immich.BulkCheckResult{ID: item.ID, Action: "reject", Reason: "duplicate", AssetID: a.ID, IsTrashed: a.IsTrashed}
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+func (s *Server) listAlbums(w http.ResponseWriter, r *http.Request) {
+	albums := []immich.Album{}
+	for _, a := range s.Albums() {
+		albums = append(albums, immich.Album{ID: a.ID, AlbumName: a.Name})
+	}
+	writeJSON(w, http.StatusOK, albums)
+}
+
+func (s *Server) createAlbum(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AlbumName string `json:"albumName"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.AlbumName == "" {
+		writeError(w, http.StatusBadRequest, "albumName should not be empty")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.newID("album")
+	s.albums[id] = &Album{ID: id, Name: req.AlbumName}
+	writeJSON(w, http.StatusCreated, immich.Album{ID: id, AlbumName: req.AlbumName})
+}
+
+func (s *Server) addToAlbum(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	album := s.albums[r.PathValue("id")]
+	if album == nil {
+		writeError(w, http.StatusBadRequest, "Not found or no album.read access")
+		return
+	}
+
+	results := make([]immich.BulkIDResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		switch {
+		case s.assets[id] == nil:
+			results = append(results, immich.BulkIDResult{ID: id, Error: "not_found"})
+		case contains(album.AssetIDs, id):
+			results = append(results, immich.BulkIDResult{ID: id, Error: immich.BulkErrorDuplicate})
+		default:
+			album.AssetIDs = append(album.AssetIDs, id)
+			results = append(results, immich.BulkIDResult{ID: id, Success: true})
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) deleteAlbum(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if s.albums[id] == nil {
+		writeError(w, http.StatusBadRequest, "Not found or no album.delete access")
+		return
+	}
+	delete(s.albums, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) upsertTags(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byValue := make(map[string]*Tag, len(s.tags))
+	for _, t := range s.tags {
+		byValue[t.Value] = t
+	}
+
+	results := make([]immich.Tag, 0, len(req.Tags))
+	for _, value := range req.Tags {
+		// Create the tag and its parents, e.g. People and People/Alice
+		var tag *Tag
+		parts := strings.Split(value, "/")
+		for n := range parts {
+			path := strings.Join(parts[:n+1], "/")
+			t, ok := byValue[path]
+			if !ok {
+				t = &Tag{ID: s.newID("tag"), Value: path}
+				if tag != nil {
+					t.ParentID = tag.ID
+				}
+				s.tags[t.ID] = t
+				byValue[path] = t
+			}
+			tag = t
+		}
+		results = append(results, immich.Tag{ID: tag.ID, Name: parts[len(parts)-1], Value: tag.Value})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) deleteTag(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if s.tags[id] == nil {
+		writeError(w, http.StatusBadRequest, "Not found or no tag.delete access")
+		return
+	}
+	delete(s.tags, id)
+	for _, a := range s.assets {
+		a.TagIDs = without(a.TagIDs, id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) tagAssets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tagID := r.PathValue("id")
+	if s.tags[tagID] == nil {
+		writeError(w, http.StatusBadRequest, "Not found or no tag.asset access")
+		return
+	}
+
+	results := make([]immich.BulkIDResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		a := s.assets[id]
+		switch {
+		case a == nil:
+			results = append(results, immich.BulkIDResult{ID: id, Error: "not_found"})
+		case contains(a.TagIDs, tagID):
+			results = append(results, immich.BulkIDResult{ID: id, Error: immich.BulkErrorDuplicate})
+		default:
+			a.TagIDs = append(a.TagIDs, tagID)
+			results = append(results, immich.BulkIDResult{ID: id, Success: true})
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) createStack(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AssetIDs []string `json:"assetIds"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.AssetIDs) < 2 {
+		writeError(w, http.StatusBadRequest, "assetIds must contain at least 2 elements")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failStacks > 0 {
+		s.failStacks--
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !s.checkIDs(w, req.AssetIDs) {
+		return
+	}
+	id := s.newID("stack")
+	s.stacks[id] = append([]string(nil), req.AssetIDs...)
+	for _, assetID := range req.AssetIDs {
+		s.assets[assetID].StackID = id
+	}
+	writeJSON(w, http.StatusCreated, immich.Stack{ID: id, PrimaryAssetID: req.AssetIDs[0]})
+}
+
+func (s *Server) createSetupToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	token := s.newID("token")
+	s.setupTokens[token] = true
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"token": token})
+}
+
+func (s *Server) importerConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ok := s.setupTokens[r.PathValue("token")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Setup token not found or expired")
+		return
+	}
+
+	var cfg immich.ImporterConfig
+	cfg.ServerURL = s.URL
+	cfg.APIKey = s.APIKey
+	cfg.OAuth.ClientID = s.OAuth.ClientID
+	cfg.OAuth.ClientSecret = s.OAuth.ClientSecret
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func contains(ids []string, id string) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func without(ids []string, id string) []string {
+	kept := ids[:0]
+	for _, x := range ids {
+		if x != id {
+			kept = append(kept, x)
+		}
+	}
+	return kept
+}
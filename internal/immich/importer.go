@@ -0,0 +1,39 @@
+package immich
+
+import (
+	"context"
+	"net/url"
+)
+
+// Endpoints of the Immich importer plugin, which hands out setup tokens that
+// carry the server URL, an API key and Google OAuth credentials
+
+// ImporterConfig is the configuration a setup token stands for
+type ImporterConfig struct {
+	ServerURL string `json:"serverUrl"`
+	APIKey    string `json:"apiKey"`
+	OAuth     struct {
+		ClientID     string `json:"clientId"`
+		ClientSecret string `json:"clientSecret"`
+	} `json:"oauth"`
+}
+
+// CreateSetupToken creates a setup token for the client's API key
+func (c *Client) CreateSetupToken(ctx context.Context) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, "POST", "/api/importer/setup-token", nil, &result); err != nil {
+		return "", err
+	}
+	return result.Token, nil
+}
+
+// ImporterConfig fetches the configuration of a setup token. It needs no API key.
+func (c *Client) ImporterConfig(ctx context.Context, token string) (*ImporterConfig, error) {
+	var cfg ImporterConfig
+	if err := c.do(ctx, "GET", "/api/importer/config/"+url.PathEscape(token), nil, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,91 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+// Version is an Immich server version
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is older than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// MediaTypes lists the file extensions the server accepts
+type MediaTypes struct {
+	Image   []string `json:"image"`
+	Video   []string `json:"video"`
+	Sidecar []string `json:"sidecar"`
+}
+
+// User is the owner of the API key
+type User struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// Ping checks that the server answers like an Immich server
+func (c *Client) Ping(ctx context.Context) error {
+	var pong struct {
+		Res string `json:"res"`
+	}
+	if err := c.do(ctx, "GET", "/api/server/ping", nil, &pong); err != nil {
+		return err
+	}
+	if pong.Res != "pong" {
+		return fmt.Errorf("unexpected response %q", pong.Res)
+	}
+	return nil
+}
+
+// Version returns the server version
+func (c *Client) Version(ctx context.Context) (Version, error) {
+	var v Version
+	err := c.do(ctx, "GET", "/api/server/version", nil, &v)
+	return v, err
+}
+
+// MediaTypes returns the file types the server accepts
+func (c *Client) MediaTypes(ctx context.Context) (MediaTypes, error) {
+	var types MediaTypes
+	err := c.do(ctx, "GET", "/api/server/media-types", nil, &types)
+	return types, err
+}
+
+// APIKeyPermissions returns the permissions of the client's API key. Servers
+// before v1.116 do not have this endpoint and answer 404.
+func (c *Client) APIKeyPermissions(ctx context.Context) ([]string, error) {
+	var key struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.do(ctx, "GET", "/api/api-keys/me", nil, &key); err != nil {
+		return nil, err
+	}
+	return key.Permissions, nil
+}
+
+// CurrentUser returns the user the API key belongs to
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.do(ctx, "GET", "/api/users/me", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,21 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stack is a group of assets shown as one, led by its primary asset
+type Stack struct {
+	ID             string `json:"id"`
+	PrimaryAssetID string `json:"primaryAssetId"`
+}
+
+// CreateStack stacks assets; the first one becomes the primary
+func (c *Client) CreateStack(ctx context.Context, assetIDs []string) (*Stack, error) {
+	var stack Stack
+	if err := c.do(ctx, "POST", "/api/stacks", map[string]interface{}{"assetIds": assetIDs}, &stack); err != nil {
+		return nil, fmt.Errorf("failed to create stack: %w", err)
+	}
+	return &stack, nil
+}
@@ -0,0 +1,41 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tag is an Immich tag. Value is the full path, e.g. "People/Alice".
+type Tag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// UpsertTags returns the tags with the given values, creating them and their
+// parents as needed
+func (c *Client) UpsertTags(ctx context.Context, values []string) ([]Tag, error) {
+	var tags []Tag
+	if err := c.do(ctx, "PUT", "/api/tags", map[string]interface{}{"tags": values}, &tags); err != nil {
+		return nil, fmt.Errorf("failed to create tags: %w", err)
+	}
+	return tags, nil
+}
+
+// DeleteTag deletes a tag, removing it from its assets
+func (c *Client) DeleteTag(ctx context.Context, tagID string) error {
+	if err := c.do(ctx, "DELETE", "/api/tags/"+tagID, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+	return nil
+}
+
+// TagAssets adds a tag to assets. Assets that have it already are reported
+// with BulkErrorDuplicate.
+func (c *Client) TagAssets(ctx context.Context, tagID string, assetIDs []string) ([]BulkIDResult, error) {
+	var results []BulkIDResult
+	if err := c.do(ctx, "PUT", "/api/tags/"+tagID+"/assets", map[string]interface{}{"ids": assetIDs}, &results); err != nil {
+		return nil, fmt.Errorf("failed to tag assets: %w", err)
+	}
+	return results, nil
+}
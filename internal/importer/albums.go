@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// Folders that hold every photo of a year rather than an album
+var yearFolderPattern = regexp.MustCompile(`(?i)^(photos from|fotos von|fotos de|photos de|foto del) \d{4}$`)
+
+// Folders that are neither albums nor year folders
+var specialFolders = map[string]bool{"archive": true, "google photos": true, "google fotos": true, "takeout": true, "failed videos": true}
+
+// Album metadata file names, depending on the account language
+var albumMetadataNames = map[string]bool{"metadata.json": true, "metadaten.json": true, "métadonnées.json": true, "metadatos.json": true}
+
+// albumName returns the Immich album for the folder an entry is in, or "" if
+// the folder is not an album. The title comes from the album's metadata.json
+// when there is one, since folder names are sanitized.
+func (idx *archiveIndex) albumName(e *entry) string {
+	dir := strings.ToLower(e.dir())
+	if name, ok := idx.albums[dir]; ok {
+		return name
+	}
+
+	folder := path.Base(e.dir())
+	name := folder
+	lower := strings.ToLower(folder)
+	if folder == "." || yearFolderPattern.MatchString(folder) || specialFolders[lower] || inFolder(e, trashFolders) || inFolder(e, lockedFolders) {
+		name = ""
+	}
+
+	if name != "" {
+		for _, j := range idx.metadata[dir] {
+			if !albumMetadataNames[strings.ToLower(j.base())] {
+				continue
+			}
+			var album struct {
+				Title string `json:"title"`
+			}
+			if data, err := readZipEntry(j.file); err == nil && json.Unmarshal(data, &album) == nil && album.Title != "" {
+				name = album.Title
+			}
+			break
+		}
+	}
+
+	idx.albums[dir] = name
+	return name
+}
+
+// queueAlbumAdd remembers to add an asset to an album on the next flush
+func queueAlbumAdd(uploadState *state.UploadState, album, assetID string) {
+	if album == "" || assetID == "" {
+		return
+	}
+	uploadState.QueueAlbumAdd(album, assetID)
+}
+
+// flushAlbums adds the queued assets to their albums, creating albums as needed.
+// The queue is part of the upload state, so additions queued before a crash
+// are made on the next run.
+func (i *Importer) flushAlbums(ctx context.Context, uploadState *state.UploadState) error {
+	for album, assetIDs := range uploadState.PendingAlbums {
+		albumID, err := i.albumID(ctx, uploadState, album)
+		if err != nil {
+			return err
+		}
+		if err := i.addToAlbum(ctx, albumID, assetIDs); err != nil {
+			return fmt.Errorf("album %q: %w", album, err)
+		}
+		delete(uploadState.PendingAlbums, album)
+	}
+	return nil
+}
+
+// albumID returns the ID of the named album: the one used earlier in this job,
+// an existing album with that name, or a new one
+func (i *Importer) albumID(ctx context.Context, uploadState *state.UploadState, name string) (string, error) {
+	if id, ok := uploadState.AlbumIDs[name]; ok {
+		return id, nil
+	}
+	if uploadState.AlbumIDs == nil {
+		uploadState.AlbumIDs = make(map[string]string)
+	}
+
+	if i.existingAlbums == nil {
+		albums, err := i.listAlbums(ctx)
+		if err != nil {
+			return "", err
+		}
+		i.existingAlbums = albums
+	}
+
+	id, ok := i.existingAlbums[name]
+	if !ok {
+		var err error
+		if id, err = i.createAlbum(ctx, name); err != nil {
+			return "", err
+		}
+		i.existingAlbums[name] = id
+		uploadState.CreatedAlbums = append(uploadState.CreatedAlbums, id)
+	}
+
+	uploadState.AlbumIDs[name] = id
+	return id, nil
+}
+
+// listAlbums returns the user's albums by name
+func (i *Importer) listAlbums(ctx context.Context) (map[string]string, error) {
+	albums, err := i.client.ListAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]string)
+	for _, a := range albums {
+		if _, ok := byName[a.AlbumName]; !ok {
+			byName[a.AlbumName] = a.ID
+		}
+	}
+	return byName, nil
+}
+
+func (i *Importer) createAlbum(ctx context.Context, name string) (string, error) {
+	album, err := i.client.CreateAlbum(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return album.ID, nil
+}
+
+// addToAlbum adds assets to an album. Assets already in it are not an error.
+func (i *Importer) addToAlbum(ctx context.Context, albumID string, assetIDs []string) error {
+	results, err := i.client.AddAssetsToAlbum(ctx, albumID, assetIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if !r.Success && r.Error != immich.BulkErrorDuplicate {
+			fmt.Printf("Warning: could not add asset %s to album: %s\n", r.ID, r.Error)
+		}
+	}
+	return nil
+}
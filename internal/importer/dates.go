@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateSource says where an asset's capture time came from
+type dateSource int
+
+// Capture time sources in order of precedence. fileCreatedAt is taken from
+// the first source that has a date:
+//
+//  1. the Takeout JSON sidecar (photoTakenTime)
+//  2. metadata embedded in the file (EXIF DateTimeOriginal, QuickTime mvhd)
+//  3. a date in the file name, see filenameParsers
+//  4. the modification time of the zip entry
+const (
+	dateUnknown dateSource = iota
+	dateSidecar
+	dateEmbedded
+	dateFilename
+	dateModified
+)
+
+// known reports whether the date is the capture time rather than a stand-in
+func (s dateSource) known() bool {
+	return s == dateSidecar || s == dateEmbedded || s == dateFilename
+}
+
+// captureTime picks the capture time of an entry with the given content
+func captureTime(e *entry, content []byte, meta *takeoutMetadata) (time.Time, dateSource) {
+	if meta != nil {
+		if t := meta.takenAt(); !t.IsZero() {
+			return t, dateSidecar
+		}
+	}
+	if t := embeddedDate(e.ext(), content); !t.IsZero() {
+		return t, dateEmbedded
+	}
+	if t := filenameDate(e.base()); !t.IsZero() {
+		return t, dateFilename
+	}
+	if !e.file.Modified.IsZero() {
+		return e.file.Modified, dateModified
+	}
+	return time.Time{}, dateUnknown
+}
+
+// filenameParser extracts a capture date from a file name, returning the
+// zero time if the name does not match
+type filenameParser func(name string) time.Time
+
+// filenameParsers are tried in order; add a parser here for a new naming scheme
+var filenameParsers = []filenameParser{
+	// Messenger downloads carry only a date: IMG-20190312-WA0004.jpg
+	patternParser(`(?i)^(?:IMG|VID|AUD|PTT|STK)-(\d{8})-WA\d+`, "20060102"),
+	// Cameras and screenshots on Android: PXL_20230405_123456789.jpg,
+	// VID_20180101_101010.mp4, Screenshot_20200101-101010.png
+	patternParser(`(\d{8})[_-](\d{6})`, "20060102150405"),
+	// Dropbox camera uploads and macOS screenshots: 2019-03-12 10.11.12.jpg,
+	// Screenshot 2020-01-01 at 10.10.10.png
+	patternParser(`(\d{4}-\d{2}-\d{2})[ _-](?:at )?(\d{2})[.:-](\d{2})[.:-](\d{2})`, "2006-01-02150405"),
+}
+
+// patternParser parses the concatenated submatches of pattern with layout
+func patternParser(pattern, layout string) filenameParser {
+	re := regexp.MustCompile(pattern)
+	return func(name string) time.Time {
+		m := re.FindStringSubmatch(name)
+		if m == nil {
+			return time.Time{}
+		}
+		t, err := time.Parse(layout, strings.Join(m[1:], ""))
+		if err != nil {
+			return time.Time{}
+		}
+		return t
+	}
+}
+
+// Dates outside this range are digits that only look like a date
+const minFilenameYear = 1990
+
+// filenameDate returns the date in a file name, or the zero time if there is
+// none. File names carry local time, which is taken as UTC.
+func filenameDate(name string) time.Time {
+	for _, parse := range filenameParsers {
+		t := parse(name)
+		if t.IsZero() || t.Year() < minFilenameYear || t.After(time.Now().AddDate(1, 0, 0)) {
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
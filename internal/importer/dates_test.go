@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilenameDate(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		{"IMG-20190312-WA0004.jpg", date(2019, 3, 12, 0, 0, 0)},
+		{"VID-20190312-WA0001.mp4", date(2019, 3, 12, 0, 0, 0)},
+		{"PXL_20230405_123456789.jpg", date(2023, 4, 5, 12, 34, 56)},
+		{"VID_20180101_101010.mp4", date(2018, 1, 1, 10, 10, 10)},
+		{"Screenshot_20200101-101010.png", date(2020, 1, 1, 10, 10, 10)},
+		{"Screenshot 2020-01-01 at 10.10.10.png", date(2020, 1, 1, 10, 10, 10)},
+		{"2019-03-12 10.11.12.jpg", date(2019, 3, 12, 10, 11, 12)},
+
+		// Year bounds
+		{"IMG_19900101_000000.jpg", date(1990, 1, 1, 0, 0, 0)},
+		{"IMG_19891231_235959.jpg", time.Time{}},
+		{"IMG-19700101-WA0001.jpg", time.Time{}},
+		{"IMG_29991231_101010.jpg", time.Time{}},
+		{"Screenshot 2999-01-01 at 10.10.10.png", time.Time{}},
+
+		// No date
+		{"DSC_1234.jpg", time.Time{}},
+		{"IMG_20191345_101010.jpg", time.Time{}},
+		{"IMG_20190101_256161.jpg", time.Time{}},
+		{"IMG-2019031-WA0004.jpg", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filenameDate(tt.name); !got.Equal(tt.want) {
+				t.Errorf("filenameDate(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
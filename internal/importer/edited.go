@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EditedPolicy decides what happens to Google Photos "-edited" copies
+type EditedPolicy string
+
+const (
+	// EditedStack uploads both and stacks them with the edited copy on top
+	EditedStack EditedPolicy = "stack"
+	// EditedKeepOriginal skips edited copies
+	EditedKeepOriginal EditedPolicy = "original"
+	// EditedKeepEdited skips originals that have an edited copy
+	EditedKeepEdited EditedPolicy = "edited"
+)
+
+// ParseEditedPolicy parses an --edited flag value
+func ParseEditedPolicy(s string) (EditedPolicy, error) {
+	switch p := EditedPolicy(s); p {
+	case EditedStack, EditedKeepOriginal, EditedKeepEdited:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid edited policy %q (want stack, original or edited)", s)
+}
+
+// Suffixes Google adds to edited copies, depending on the account language
+var editedSuffixes = []string{"-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-bewerkt"}
+
+// editedOriginalKey returns the stem key of the original if e is an edited
+// copy, e.g. "takeout/photos/img_1" for "Takeout/Photos/IMG_1-edited.jpg"
+func editedOriginalKey(e *entry) (string, bool) {
+	key := e.stemKey()
+	for _, suffix := range editedSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return strings.TrimSuffix(key, suffix), true
+		}
+	}
+	return "", false
+}
+
+// applyEditedPolicy matches edited copies with their originals. Edited copies
+// always take the original's JSON metadata, since Takeout only writes one.
+func applyEditedPolicy(assets []*asset, policy EditedPolicy) []*asset {
+	originals := make(map[string][]*asset)
+	for _, a := range assets {
+		if _, edited := editedOriginalKey(a.entry); edited || a.entry.kind != kindImage {
+			continue
+		}
+		originals[a.entry.stemKey()] = append(originals[a.entry.stemKey()], a)
+	}
+
+	// Pair each edited copy with its original
+	editedOf := make(map[*asset]*asset)
+	for _, a := range assets {
+		key, edited := editedOriginalKey(a.entry)
+		if !edited {
+			continue
+		}
+		original := pickOriginal(originals[key], a.entry.ext())
+		if original == nil || editedOf[original] != nil {
+			continue
+		}
+		editedOf[original] = a
+		if original.metadata != nil {
+			a.metadata = original.metadata
+		}
+	}
+
+	skip := make(map[*asset]bool)
+	for original, edited := range editedOf {
+		switch policy {
+		case EditedStack:
+			// The edited copy is the primary; it takes the original's place
+			addToStack(edited, original)
+			skip[original] = true
+		case EditedKeepOriginal:
+			skip[edited] = true
+		case EditedKeepEdited:
+			// Keep the Live Photo video with whichever still is uploaded
+			if edited.liveVideo == nil {
+				edited.liveVideo = original.liveVideo
+			}
+			skip[original] = true
+		}
+	}
+
+	kept := assets[:0]
+	for _, a := range assets {
+		if !skip[a] {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// pickOriginal chooses the original of an edited copy among the images with
+// the same name: the one with the same extension, else the first non-RAW one
+func pickOriginal(candidates []*asset, ext string) *asset {
+	var fallback *asset
+	for _, c := range candidates {
+		if c.entry.ext() == ext {
+			return c
+		}
+		if fallback == nil && !rawExts[c.entry.ext()] {
+			fallback = c
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// liveVideos maps each still, top-level or stacked, to its Live Photo video
+func liveVideos(assets []*asset) map[string]string {
+	videos := make(map[string]string)
+	for _, a := range assets {
+		for _, member := range append([]*asset{a}, a.stack...) {
+			if member.liveVideo != nil {
+				videos[member.entry.base()] = member.liveVideo.base()
+			}
+		}
+	}
+	return videos
+}
+
+func TestApplyEditedPolicy(t *testing.T) {
+	photos := []string{"P/IMG_1.jpg", "P/IMG_1-edited.jpg", "P/IMG_2.jpg"}
+	live := []string{"P/IMG_3.HEIC", "P/IMG_3.MOV", "P/IMG_3-edited.HEIC"}
+
+	tests := []struct {
+		name   string
+		policy EditedPolicy
+		files  []string
+		want   []string
+		live   map[string]string
+	}{
+		{"stack", EditedStack, photos, []string{"IMG_1-edited.jpg: IMG_1.jpg", "IMG_2.jpg"}, map[string]string{}},
+		{"original", EditedKeepOriginal, photos, []string{"IMG_1.jpg", "IMG_2.jpg"}, map[string]string{}},
+		{"edited", EditedKeepEdited, photos, []string{"IMG_1-edited.jpg", "IMG_2.jpg"}, map[string]string{}},
+		{"stack live photo", EditedStack, live, []string{"IMG_3-edited.HEIC: IMG_3.HEIC"}, map[string]string{"IMG_3.HEIC": "IMG_3.MOV"}},
+		{"original live photo", EditedKeepOriginal, live, []string{"IMG_3.HEIC"}, map[string]string{"IMG_3.HEIC": "IMG_3.MOV"}},
+		{"edited live photo", EditedKeepEdited, live, []string{"IMG_3-edited.HEIC"}, map[string]string{"IMG_3-edited.HEIC": "IMG_3.MOV"}},
+		{
+			"localized suffix",
+			EditedKeepEdited,
+			[]string{"P/IMG_4.jpg", "P/IMG_4-bearbeitet.jpg"},
+			[]string{"IMG_4-bearbeitet.jpg"},
+			map[string]string{},
+		},
+		{
+			"original with the same extension",
+			EditedStack,
+			[]string{"P/IMG_5.CR2", "P/IMG_5.jpg", "P/IMG_5-edited.jpg"},
+			[]string{"IMG_5.CR2", "IMG_5-edited.jpg: IMG_5.jpg"},
+			map[string]string{},
+		},
+		{
+			"original in another folder",
+			EditedKeepEdited,
+			[]string{"A/IMG_6.jpg", "B/IMG_6-edited.jpg"},
+			[]string{"IMG_6.jpg", "IMG_6-edited.jpg"},
+			map[string]string{},
+		},
+		{
+			"video is no original",
+			EditedKeepEdited,
+			[]string{"P/VID_7.mp4", "P/VID_7-edited.mp4"},
+			[]string{"VID_7.mp4", "VID_7-edited.mp4"},
+			map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyEditedPolicy(pairLivePhotos(testAssets(tt.files...)), tt.policy)
+			if l := layout(got); !reflect.DeepEqual(l, tt.want) {
+				t.Errorf("applyEditedPolicy = %q, want %q", l, tt.want)
+			}
+			if v := liveVideos(got); !reflect.DeepEqual(v, tt.live) {
+				t.Errorf("live videos = %v, want %v", v, tt.live)
+			}
+		})
+	}
+}
+
+func TestEditedCopyTakesOriginalMetadata(t *testing.T) {
+	assets := testAssets("P/IMG_1.jpg", "P/IMG_1-edited.jpg")
+	original, edited := assets[0], assets[1]
+	original.metadata = &takeoutMetadata{Title: "IMG_1.jpg"}
+
+	applyEditedPolicy(assets, EditedKeepEdited)
+	if edited.metadata != original.metadata {
+		t.Errorf("edited copy metadata = %v, want the original's", edited.metadata)
+	}
+}
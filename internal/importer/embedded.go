@@ -0,0 +1,226 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// embeddedDate returns the capture time stored in the file itself: EXIF
+// DateTimeOriginal for JPEG, HEIC and TIFF-based images, the movie header
+// creation time for MP4 and MOV. It returns the zero time if there is none.
+func embeddedDate(ext string, content []byte) time.Time {
+	switch ext {
+	case ".jpg", ".jpeg", ".jpe":
+		return jpegDate(content)
+	case ".heic", ".heif", ".hif", ".avif":
+		return heicDate(content)
+	case ".tif", ".tiff", ".dng", ".nef", ".arw", ".cr2", ".orf", ".pef", ".rw2", ".srw":
+		return exifDate(content)
+	case ".mp4", ".mov", ".m4v", ".3gp", ".3gpp", ".3g2", ".insv":
+		return quickTimeDate(content)
+	}
+	return time.Time{}
+}
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegDate reads the EXIF block from the APP1 segment of a JPEG
+func jpegDate(data []byte) time.Time {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return time.Time{}
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return time.Time{}
+		}
+		marker := data[pos+1]
+		if marker == 0xD9 || marker == 0xDA { // end of image, start of scan
+			return time.Time{}
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return time.Time{}
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			return exifDate(segment[len(exifHeader):])
+		}
+		pos += 2 + size
+	}
+	return time.Time{}
+}
+
+// heicDate finds the EXIF item of a HEIC image. Rather than resolving the item
+// location, it looks for the "Exif" header that precedes the TIFF data.
+func heicDate(data []byte) time.Time {
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], exifHeader)
+		if i < 0 {
+			return time.Time{}
+		}
+		start := offset + i + len(exifHeader)
+		if t := exifDate(data[start:]); !t.IsZero() {
+			return t
+		}
+		offset = start
+	}
+}
+
+// EXIF tags used for the capture time
+const (
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+// exifDate reads DateTimeOriginal and OffsetTimeOriginal from TIFF-structured
+// EXIF data. Without an offset the time is taken as UTC.
+func exifDate(tiff []byte) time.Time {
+	if len(tiff) < 8 {
+		return time.Time{}
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return time.Time{}
+	}
+
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:]))
+	exifOffset, ok := ifd0[tagExifIFD]
+	if !ok {
+		return time.Time{}
+	}
+	exif := readIFD(tiff, order, exifOffset.Uint32(order))
+
+	original := asciiValue(tiff, order, exif[tagDateTimeOriginal])
+	if original == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", original)
+	if err != nil {
+		return time.Time{}
+	}
+
+	if offset := asciiValue(tiff, order, exif[tagOffsetTimeOriginal]); offset != "" {
+		if zone, err := time.Parse("-07:00", offset); err == nil {
+			_, secs := zone.Zone()
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone(offset, secs))
+		}
+	}
+	return t
+}
+
+// ifdEntry is the raw 12-byte directory entry, keyed by tag in readIFD
+type ifdEntry []byte
+
+// readIFD returns the entries of the image file directory at offset
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]ifdEntry {
+	entries := make(map[uint16]ifdEntry)
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return entries
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	for n := 0; n < count && pos+12 <= len(tiff); n++ {
+		entries[order.Uint16(tiff[pos:])] = ifdEntry(tiff[pos : pos+12])
+		pos += 12
+	}
+	return entries
+}
+
+// Uint32 returns the value of a LONG entry
+func (e ifdEntry) Uint32(order binary.ByteOrder) uint32 {
+	return order.Uint32(e[8:])
+}
+
+// asciiValue returns the string value of an ASCII entry, or "" if it is missing
+func asciiValue(tiff []byte, order binary.ByteOrder, e ifdEntry) string {
+	const typeASCII = 2
+	if e == nil || order.Uint16(e[2:]) != typeASCII {
+		return ""
+	}
+	count := order.Uint32(e[4:])
+	var value []byte
+	if count <= 4 {
+		value = e[8 : 8+count]
+	} else {
+		offset := order.Uint32(e[8:])
+		if uint64(offset)+uint64(count) > uint64(len(tiff)) {
+			return ""
+		}
+		value = tiff[offset : offset+count]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
+
+// Start of the QuickTime epoch
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// quickTimeDate reads the creation time from the mvhd box inside moov
+func quickTimeDate(data []byte) time.Time {
+	moov := findBox(data, "moov")
+	if moov == nil {
+		return time.Time{}
+	}
+	mvhd := findBox(moov, "mvhd")
+	if len(mvhd) < 4 {
+		return time.Time{}
+	}
+
+	var secs uint64
+	switch mvhd[0] { // version
+	case 0:
+		if len(mvhd) < 8 {
+			return time.Time{}
+		}
+		secs = uint64(binary.BigEndian.Uint32(mvhd[4:]))
+	case 1:
+		if len(mvhd) < 12 {
+			return time.Time{}
+		}
+		secs = binary.BigEndian.Uint64(mvhd[4:])
+	default:
+		return time.Time{}
+	}
+
+	// Many encoders leave the creation time unset
+	if secs == 0 {
+		return time.Time{}
+	}
+	return quickTimeEpoch.Add(time.Duration(secs) * time.Second)
+}
+
+// findBox returns the payload of the first box of the given type at the top
+// level of data
+func findBox(data []byte, boxType string) []byte {
+	for pos := 0; pos+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[pos:]))
+		header := uint64(8)
+		switch size {
+		case 0: // box extends to the end of the data
+			size = uint64(len(data) - pos)
+		case 1: // 64-bit size follows the type
+			if pos+16 > len(data) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[pos+8:])
+			header = 16
+		}
+		if size < header || uint64(pos)+size > uint64(len(data)) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == boxType {
+			return data[uint64(pos)+header : uint64(pos)+size]
+		}
+		pos += int(size)
+	}
+	return nil
+}
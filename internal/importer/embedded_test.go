@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// tiffExif builds TIFF-structured EXIF data holding DateTimeOriginal and,
+// if offset is set, OffsetTimeOriginal
+func tiffExif(order binary.ByteOrder, original, offset string) []byte {
+	type field struct {
+		tag   uint16
+		value string
+	}
+	fields := []field{{tagDateTimeOriginal, original}}
+	if offset != "" {
+		fields = append(fields, field{tagOffsetTimeOriginal, offset})
+	}
+
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	u16 := func(v uint16) { binary.Write(&buf, order, v) }
+	u32 := func(v uint32) { binary.Write(&buf, order, v) }
+
+	// IFD0 at 8 with only the Exif IFD pointer, the Exif IFD right after it
+	const ifd0 = 8
+	exifIFD := uint32(ifd0 + 2 + 12 + 4)
+	values := exifIFD + 2 + uint32(12*len(fields)) + 4
+	u32(ifd0)
+	u16(1)
+	u16(tagExifIFD)
+	u16(4) // LONG
+	u32(1)
+	u32(exifIFD)
+	u32(0)
+
+	u16(uint16(len(fields)))
+	var data []byte
+	for _, f := range fields {
+		value := append([]byte(f.value), 0)
+		u16(f.tag)
+		u16(2) // ASCII
+		u32(uint32(len(value)))
+		if len(value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], value)
+			buf.Write(inline[:])
+		} else {
+			u32(values + uint32(len(data)))
+			data = append(data, value...)
+		}
+	}
+	u32(0)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// jpegWithExif wraps EXIF data in the APP1 segment of a minimal JPEG
+func jpegWithExif(tiff []byte) []byte {
+	app1 := append(append([]byte{}, exifHeader...), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00} // SOI, empty APP0
+	data = append(data, 0xFF, 0xE1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(app1)+2))
+	data = append(data, app1...)
+	return append(data, 0xFF, 0xD9)
+}
+
+// box builds an ISO base media box
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	data := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	data = append(data, boxType...)
+	return append(data, body...)
+}
+
+// heicWithExif builds a HEIC file whose Exif item is stored in mdat, preceded
+// by its header offset like real files
+func heicWithExif(tiff []byte) []byte {
+	item := append([]byte{0, 0, 0, 6}, exifHeader...)
+	item = append(item, tiff...)
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")),
+		box("meta", []byte{0, 0, 0, 0}, box("iinf", []byte{0, 0, 0, 0, 0, 0})),
+		box("mdat", item),
+	}, nil)
+}
+
+// movie builds an MP4 whose mvhd box has the given version and creation time
+func movie(version byte, created time.Time) []byte {
+	secs := uint64(created.Sub(quickTimeEpoch) / time.Second)
+	mvhd := []byte{version, 0, 0, 0}
+	if version == 1 {
+		mvhd = binary.BigEndian.AppendUint64(mvhd, secs)
+		mvhd = binary.BigEndian.AppendUint64(mvhd, secs) // modification time
+	} else {
+		mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(secs))
+		mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(secs))
+	}
+	mvhd = append(mvhd, make([]byte, 80)...)
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		box("moov", box("mvhd", mvhd), box("trak")),
+		box("mdat", []byte("not really video")),
+	}, nil)
+}
+
+func TestEmbeddedDate(t *testing.T) {
+	utc := time.Date(2021, 7, 4, 18, 30, 15, 0, time.UTC)
+	zoned := time.Date(2021, 7, 4, 18, 30, 15, 0, time.FixedZone("+02:00", 2*60*60))
+	late := time.Date(2150, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		ext     string
+		content []byte
+		want    time.Time
+	}{
+		{"jpeg little-endian", ".jpg", jpegWithExif(tiffExif(binary.LittleEndian, "2021:07:04 18:30:15", "")), utc},
+		{"jpeg big-endian", ".jpeg", jpegWithExif(tiffExif(binary.BigEndian, "2021:07:04 18:30:15", "")), utc},
+		{"jpeg with offset", ".jpg", jpegWithExif(tiffExif(binary.LittleEndian, "2021:07:04 18:30:15", "+02:00")), zoned},
+		{"tiff", ".dng", tiffExif(binary.BigEndian, "2021:07:04 18:30:15", "+02:00"), zoned},
+		{"heic", ".heic", heicWithExif(tiffExif(binary.BigEndian, "2021:07:04 18:30:15", "")), utc},
+		{"mvhd version 0", ".mp4", movie(0, utc), utc},
+		{"mvhd version 1", ".mov", movie(1, late), late},
+		{"unset creation time", ".mp4", movie(0, quickTimeEpoch), time.Time{}},
+		{"invalid date", ".jpg", jpegWithExif(tiffExif(binary.LittleEndian, "0000:00:00 00:00:00", "")), time.Time{}},
+		{"no exif", ".jpg", []byte{0xFF, 0xD8, 0xFF, 0xD9}, time.Time{}},
+		{"not an image", ".jpg", []byte("<html></html>"), time.Time{}},
+		{"unknown extension", ".png", jpegWithExif(tiffExif(binary.LittleEndian, "2021:07:04 18:30:15", "")), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := embeddedDate(tt.ext, tt.content)
+			if !got.Equal(tt.want) {
+				t.Errorf("embeddedDate = %v, want %v", got, tt.want)
+			}
+			if !tt.want.IsZero() && got.Format(time.RFC3339) != tt.want.Format(time.RFC3339) {
+				t.Errorf("embeddedDate = %v, want zone of %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedDateMalformed(t *testing.T) {
+	tiff := tiffExif(binary.LittleEndian, "2021:07:04 18:30:15", "+02:00")
+
+	// Every truncation of a valid file must be handled without a panic
+	valid := map[string][]byte{
+		".jpg":  jpegWithExif(tiff),
+		".heic": heicWithExif(tiff),
+		".tif":  tiff,
+		".mp4":  movie(1, time.Date(2021, 7, 4, 0, 0, 0, 0, time.UTC)),
+	}
+	for ext, content := range valid {
+		for n := 0; n < len(content); n++ {
+			embeddedDate(ext, content[:n])
+		}
+	}
+
+	// Offsets pointing past the end of the data
+	outOfRange := func(patch func(b []byte)) []byte {
+		b := append([]byte{}, tiff...)
+		patch(b)
+		return b
+	}
+	tests := map[string][]byte{
+		"IFD0 offset":        outOfRange(func(b []byte) { binary.LittleEndian.PutUint32(b[4:], 0xFFFFFFF0) }),
+		"Exif IFD offset":    outOfRange(func(b []byte) { binary.LittleEndian.PutUint32(b[18:], 0xFFFFFFFF) }),
+		"value offset":       outOfRange(func(b []byte) { binary.LittleEndian.PutUint32(b[36:], 0xFFFFFFFA) }),
+		"value count":        outOfRange(func(b []byte) { binary.LittleEndian.PutUint32(b[32:], 0xFFFFFFFF) }),
+		"huge mvhd box":      box("moov", []byte{0xFF, 0xFF, 0xFF, 0xFF, 'm', 'v', 'h', 'd'}),
+		"64-bit box size":    append([]byte{0, 0, 0, 1, 'm', 'o', 'o', 'v'}, bytes.Repeat([]byte{0xFF}, 8)...),
+		"truncated 64-bit":   []byte{0, 0, 0, 1, 'm', 'o', 'o', 'v', 0, 0},
+		"box smaller than 8": []byte{0, 0, 0, 4, 'm', 'o', 'o', 'v'},
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, ext := range []string{".tif", ".mp4"} {
+				if got := embeddedDate(ext, content); !got.IsZero() {
+					t.Errorf("embeddedDate(%s) = %v, want zero time", ext, got)
+				}
+			}
+		})
+	}
+}
+
+func FuzzEmbeddedDate(f *testing.F) {
+	tiff := tiffExif(binary.BigEndian, "2021:07:04 18:30:15", "-05:00")
+	f.Add(jpegWithExif(tiff))
+	f.Add(heicWithExif(tiff))
+	f.Add(tiff)
+	f.Add(movie(0, time.Date(2021, 7, 4, 0, 0, 0, 0, time.UTC)))
+	f.Add(movie(1, time.Date(2021, 7, 4, 0, 0, 0, 0, time.UTC)))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		for _, ext := range []string{".jpg", ".heic", ".tif", ".mp4"} {
+			embeddedDate(ext, content)
+		}
+	})
+}
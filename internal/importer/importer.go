@@ -2,220 +2,561 @@ package importer
 
 import (
 	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/davidaniva/immich-importer/internal/immich"
 	"github.com/davidaniva/immich-importer/internal/state"
 )
 
 // Importer handles uploading photos to Immich
 type Importer struct {
-	serverURL  string
-	apiKey     string
-	httpClient *http.Client
+	client     *immich.Client
+	options    Options
+	classifier classifier
+	report     *Report
+
+	// The user's albums by name
+	existingAlbums map[string]string
+
+	// Settings of the current job, see applyJobSettings
+	deviceID string
+	jobTag   string
+	jobAlbum string
+}
+
+// Options controls how Takeout entries are turned into Immich assets
+type Options struct {
+	// LivePhotos decides what happens to the video half of Live Photos and
+	// motion photos. Defaults to LivePhotoLink.
+	LivePhotos LivePhotoPolicy
+
+	// Edited decides what happens to "-edited" copies. Defaults to EditedStack.
+	Edited EditedPolicy
+
+	// NoAutoStack disables stacking RAW+JPEG pairs and burst sequences
+	NoAutoStack bool
+
+	// Trashed decides what happens to items from the Google Photos trash.
+	// Defaults to TrashSkip.
+	Trashed TrashPolicy
+
+	// PeopleTagPrefix is the parent tag of the tags created for the people
+	// named in Google Photos. Defaults to DefaultPeopleTagPrefix.
+	PeopleTagPrefix string
+
+	// NoPeopleTags disables tagging assets with people names
+	NoPeopleTags bool
+
+	// DeviceID is sent as the deviceId of every upload. Defaults to
+	// DefaultDeviceID.
+	DeviceID string
+
+	// JobTag is added to every asset; "{job}" is replaced by the job ID.
+	// Empty for no tag.
+	JobTag string
+
+	// JobAlbum is an album every asset is added to. Empty for none.
+	JobAlbum string
+}
+
+// Permissions returns the API key permissions the options need on top of
+// those every import needs, which preflight checks
+func (o Options) Permissions() []string {
+	var permissions []string
+	if o.JobTag != "" || !o.NoPeopleTags {
+		permissions = append(permissions, "tag.create", "tag.asset")
+	}
+	if o.Edited == "" || o.Edited == EditedStack || !o.NoAutoStack {
+		permissions = append(permissions, "stack.create")
+	}
+	if o.Trashed == TrashImport {
+		permissions = append(permissions, "asset.delete")
+	}
+	return permissions
+}
+
+// DefaultDeviceID is the deviceId of uploads unless configured otherwise
+const DefaultDeviceID = "immich-importer"
+
+// DefaultJobTag is the suggested tag for every asset of a job
+const DefaultJobTag = "google-takeout/{job}"
+
+// applyJobSettings records the device ID, tag and album of a job on its
+// first upload, and uses the recorded ones when it is resumed
+func (i *Importer) applyJobSettings(jobState *state.JobState) {
+	if jobState.DeviceID == "" {
+		jobState.DeviceID = i.options.DeviceID
+		jobState.Tag = strings.ReplaceAll(i.options.JobTag, "{job}", jobState.ID)
+		jobState.Album = strings.ReplaceAll(i.options.JobAlbum, "{job}", jobState.ID)
+	}
+	i.deviceID = jobState.DeviceID
+	i.jobTag = jobState.Tag
+	i.jobAlbum = jobState.Album
+}
+
+// checkUser records the Immich user a job uploads as on its first run, and
+// makes sure it is resumed as the same user. A rollback can only delete the
+// assets of that user.
+func (i *Importer) checkUser(ctx context.Context, jobState *state.JobState) error {
+	user, err := i.client.CurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the Immich user: %w", err)
+	}
+	if jobState.UserID == "" {
+		jobState.UserID = user.ID
+	}
+	if user.ID != jobState.UserID {
+		return fmt.Errorf("the job uploaded as another Immich user; use an API key of user %s", jobState.UserID)
+	}
+	return nil
 }
 
 // ProgressCallback is called with progress updates
 type ProgressCallback func(phase string, current, total int, currentFile string)
 
 // New creates a new Importer
-func New(serverURL, apiKey string) *Importer {
+func New(serverURL, apiKey string, options Options) *Importer {
+	return NewWithClient(immich.New(serverURL, apiKey), options)
+}
+
+// NewWithClient creates an importer that uses the given Immich client
+func NewWithClient(client *immich.Client, options Options) *Importer {
+	if options.LivePhotos == "" {
+		options.LivePhotos = LivePhotoLink
+	}
+	if options.Edited == "" {
+		options.Edited = EditedStack
+	}
+	if options.Trashed == "" {
+		options.Trashed = TrashSkip
+	}
+	if options.PeopleTagPrefix == "" {
+		options.PeopleTagPrefix = DefaultPeopleTagPrefix
+	}
+	if options.DeviceID == "" {
+		options.DeviceID = DefaultDeviceID
+	}
+
 	return &Importer{
-		serverURL: serverURL,
-		apiKey:    apiKey,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute, // Long timeout for uploads
-		},
+		client:     client,
+		options:    options,
+		classifier: newClassifier(DefaultMediaTypes),
+		report:     newReport(),
+		deviceID:   options.DeviceID,
 	}
 }
 
-// ImportFiles imports all downloaded files to Immich
-func (i *Importer) ImportFiles(ctx context.Context, jobState *state.JobState, progress ProgressCallback) error {
-	// Initialize upload state if needed
-	if jobState.UploadState == nil {
-		jobState.UploadState = &state.UploadState{
-			UploadedFiles: []string{},
-		}
+// SetMediaTypes replaces the bundled media types with the server's list. A
+// category the server returns empty keeps the bundled types, so a partial
+// answer does not turn every photo or video into an unsupported file.
+func (i *Importer) SetMediaTypes(types MediaTypes) {
+	if len(types.Image) == 0 {
+		types.Image = DefaultMediaTypes.Image
+	}
+	if len(types.Video) == 0 {
+		types.Video = DefaultMediaTypes.Video
+	}
+	if len(types.Sidecar) == 0 {
+		types.Sidecar = DefaultMediaTypes.Sidecar
 	}
+	i.classifier = newClassifier(types)
+}
 
-	// Create a set of already uploaded files
-	uploadedSet := make(map[string]bool)
-	for _, f := range jobState.UploadState.UploadedFiles {
-		uploadedSet[f] = true
+// Report returns what was skipped during the last import or scan
+func (i *Importer) Report() *Report {
+	return i.report
+}
+
+// Scan classifies the entries of all downloaded archives without uploading
+// anything. It returns the number of assets that would be uploaded.
+func (i *Importer) Scan(jobState *state.JobState) (int, error) {
+	i.report = newReport()
+
+	idx, err := i.openIndex(jobState.Files)
+	if err != nil {
+		return 0, err
 	}
+	defer idx.Close()
 
-	// Process each downloaded file
-	for _, file := range jobState.Files {
-		if !file.Downloaded || file.LocalPath == "" {
-			continue
-		}
+	return countAssets(i.plan(idx)), nil
+}
 
-		// Check if it's a zip file
-		if strings.HasSuffix(strings.ToLower(file.Name), ".zip") {
-			if err := i.processZipFile(ctx, file.LocalPath, jobState, uploadedSet, progress); err != nil {
-				return err
+// asset is one upload to Immich: a media entry and the entries that go with it
+type asset struct {
+	entry    *entry
+	sidecar  *entry           // XMP sidecar from the archive
+	metadata *takeoutMetadata // from the Takeout JSON sidecar, may be nil
+
+	// Where Google Photos kept the asset, see classifyVisibility
+	trashed bool
+	locked  bool
+
+	// album is the Immich album the asset's folder stands for, if any
+	album string
+
+	// liveVideo is the video half of a Live Photo, uploaded before the still
+	liveVideo *entry
+
+	// stack holds assets stacked under this one, which is the stack's primary
+	stack []*asset
+}
+
+// entries returns the archive entries that are uploaded as part of the asset
+func (a *asset) entries() []*entry {
+	entries := []*entry{a.entry}
+	if a.liveVideo != nil {
+		entries = append(entries, a.liveVideo)
+	}
+	for _, s := range a.stack {
+		entries = append(entries, s.entries()...)
+	}
+	return entries
+}
+
+// size returns the number of timeline items the asset and its stack make up
+func (a *asset) size() int {
+	n := 1
+	for _, s := range a.stack {
+		n += s.size()
+	}
+	return n
+}
+
+func countAssets(assets []*asset) int {
+	n := 0
+	for _, a := range assets {
+		n += a.size()
+	}
+	return n
+}
+
+// plan turns the indexed entries into the assets to upload
+func (i *Importer) plan(idx *archiveIndex) []*asset {
+	assets := make([]*asset, 0, len(idx.media))
+	for _, e := range idx.media {
+		a := &asset{entry: e, sidecar: idx.sidecarFor(e), album: idx.albumName(e)}
+		if metaEntry := idx.findMetadata(e); metaEntry != nil {
+			meta, err := readMetadata(metaEntry)
+			if err != nil {
+				fmt.Printf("Warning: could not read %s: %v\n", metaEntry.file.Name, err)
 			}
+			a.metadata = meta
 		}
+		assets = append(assets, a)
 	}
 
-	return nil
+	if i.options.LivePhotos != LivePhotoSeparate {
+		assets = pairLivePhotos(assets)
+	}
+	assets = applyEditedPolicy(assets, i.options.Edited)
+	if !i.options.NoAutoStack {
+		assets = stackSiblings(assets)
+	}
+	assets = i.applyTrashPolicy(assets)
+
+	return assets
 }
 
-func (i *Importer) processZipFile(ctx context.Context, zipPath string, jobState *state.JobState, uploadedSet map[string]bool, progress ProgressCallback) error {
-	reader, err := zip.OpenReader(zipPath)
+// ImportFiles imports all downloaded files to Immich
+func (i *Importer) ImportFiles(ctx context.Context, jobState *state.JobState, progress ProgressCallback) error {
+	uploadState, err := jobState.OpenUploadState()
 	if err != nil {
-		return fmt.Errorf("failed to open zip: %w", err)
+		return err
+	}
+	defer jobState.Close()
+	i.report = newReport()
+	i.applyJobSettings(jobState)
+	if err := i.checkUser(ctx, jobState); err != nil {
+		return err
 	}
-	defer reader.Close()
 
-	// Count total files
-	var photoFiles []*zip.File
-	for _, f := range reader.File {
-		if !f.FileInfo().IsDir() && isMediaFile(f.Name) {
-			photoFiles = append(photoFiles, f)
-		}
+	// Index every downloaded archive, so related files are found across parts
+	idx, err := i.openIndex(jobState.Files)
+	if err != nil {
+		return err
 	}
+	defer idx.Close()
 
-	jobState.UploadState.TotalPhotos += len(photoFiles)
+	assets := i.plan(idx)
+	uploadState.TotalPhotos = countAssets(assets)
 
-	// Process each file
-	for _, f := range photoFiles {
+	err = i.processAssets(ctx, assets, jobState, progress)
+	if ctx.Err() != nil {
+		// Interrupted: still file what was uploaded into its albums
+		i.saveState(context.WithoutCancel(ctx), jobState)
+	}
+	return err
+}
+
+func (i *Importer) processAssets(ctx context.Context, assets []*asset, jobState *state.JobState, progress ProgressCallback) error {
+	for _, a := range assets {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		// Generate unique ID for this file
-		fileID := fmt.Sprintf("%s:%s", zipPath, f.Name)
-		if uploadedSet[fileID] {
+		if isUploaded(a, jobState.UploadState) {
 			continue // Already uploaded
 		}
 
-		progress("uploading", jobState.UploadState.UploadedPhotos, jobState.UploadState.TotalPhotos, f.Name)
+		progress("uploading", jobState.UploadState.UploadedPhotos, jobState.UploadState.TotalPhotos, a.entry.file.Name)
 
 		// Extract and upload
-		if err := i.uploadZipEntry(ctx, f); err != nil {
+		if _, _, err := i.uploadPlannedAsset(ctx, a, jobState.UploadState); err != nil {
 			// Log error but continue with other files
-			fmt.Printf("Warning: failed to upload %s: %v\n", f.Name, err)
+			fmt.Printf("Warning: failed to upload %s: %v\n", a.entry.file.Name, err)
 			continue
 		}
 
 		// Mark as uploaded
-		uploadedSet[fileID] = true
-		jobState.UploadState.UploadedFiles = append(jobState.UploadState.UploadedFiles, fileID)
-		jobState.UploadState.UploadedPhotos++
+		var ids []string
+		for _, e := range a.entries() {
+			ids = append(ids, e.id())
+		}
+		before := jobState.UploadState.UploadedPhotos
+		if err := jobState.MarkUploaded(ids, a.size()); err != nil {
+			return err
+		}
 
-		// Save state periodically
-		if jobState.UploadState.UploadedPhotos%100 == 0 {
-			jobState.Save()
+		// Save state periodically, which also compacts the journal
+		if before/100 != jobState.UploadState.UploadedPhotos/100 {
+			if err := i.saveState(ctx, jobState); err != nil {
+				return err
+			}
 		}
 	}
 
-	return nil
+	return i.saveState(ctx, jobState)
 }
 
-func (i *Importer) uploadZipEntry(ctx context.Context, f *zip.File) error {
-	// Open file in archive
-	rc, err := f.Open()
-	if err != nil {
+// saveState adds queued assets to their albums and tags, moves queued ones to
+// the trash, and saves the job state
+func (i *Importer) saveState(ctx context.Context, jobState *state.JobState) error {
+	if err := i.flushAlbums(ctx, jobState.UploadState); err != nil {
 		return err
 	}
-	defer rc.Close()
+	if err := i.flushTags(ctx, jobState.UploadState); err != nil {
+		return err
+	}
+	if err := i.flushTrash(ctx, jobState.UploadState); err != nil {
+		return err
+	}
+	return jobState.Save()
+}
 
-	// Read file content
-	content, err := io.ReadAll(rc)
+func isUploaded(a *asset, uploadState *state.UploadState) bool {
+	for _, e := range a.entries() {
+		if !uploadState.Uploaded(e.id()) {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadPlannedAsset uploads an asset, preceded by its Live Photo video and
+// followed by the assets stacked under it, and queues it for its album. It
+// returns the Immich asset ID and whether the content was new to this job.
+// Created stacks are recorded in the upload state.
+func (i *Importer) uploadPlannedAsset(ctx context.Context, a *asset, uploadState *state.UploadState) (string, bool, error) {
+	req, err := newUploadRequest(a.entry, a.sidecar, a.metadata)
 	if err != nil {
-		return err
+		return "", false, err
+	}
+	req.visibility = a.visibility()
+	if a.metadata != nil {
+		req.isFavorite = a.metadata.Favorited
 	}
 
-	// Get modification time
-	modTime := f.Modified
-	if modTime.IsZero() {
-		modTime = time.Now()
+	if a.liveVideo != nil {
+		videoReq, err := newUploadRequest(a.liveVideo, nil, a.metadata)
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case req.visibility != "":
+			// A locked or archived still takes its video along
+			videoReq.visibility = req.visibility
+		case i.options.LivePhotos == LivePhotoHide:
+			videoReq.visibility = "hidden"
+		}
+
+		videoID, videoFresh, err := i.uploadOnce(ctx, a.liveVideo, videoReq, uploadState)
+		if err != nil {
+			return "", false, fmt.Errorf("live photo video %s: %w", a.liveVideo.base(), err)
+		}
+		if createdByJob(uploadState, a.liveVideo, videoFresh) {
+			queueTag(uploadState, i.jobTag, videoID)
+		}
+		if i.options.LivePhotos == LivePhotoLink {
+			req.livePhotoVideoID = videoID
+		}
 	}
 
-	// Upload to Immich
-	return i.uploadAsset(ctx, filepath.Base(f.Name), content, modTime)
-}
+	assetID, fresh, err := i.uploadOnce(ctx, a.entry, req, uploadState)
+	if err != nil {
+		return "", false, err
+	}
+	queueAlbumAdd(uploadState, a.album, assetID)
+	if createdByJob(uploadState, a.entry, fresh) {
+		queueAlbumAdd(uploadState, i.jobAlbum, assetID)
+		queueTag(uploadState, i.jobTag, assetID)
+	}
+	for _, tag := range i.peopleTags(a) {
+		queueTag(uploadState, tag, assetID)
+	}
+	if fresh && !req.dateSource.known() {
+		i.report.Undated = append(i.report.Undated, UndatedAsset{Name: a.entry.file.Name, Used: req.modTime})
+	}
+
+	// Items from the Google Photos trash go to the Immich trash, unless
+	// Immich had them already
+	if a.trashed && createdByJob(uploadState, a.entry, fresh) {
+		uploadState.QueueTrash(assetID)
+	}
+
+	if len(a.stack) == 0 {
+		return assetID, fresh, nil
+	}
+
+	// Upload the stacked assets and stack them under this one
+	ids := []string{assetID}
+	for _, s := range a.stack {
+		id, _, err := i.uploadPlannedAsset(ctx, s, uploadState)
+		if err != nil {
+			return "", false, fmt.Errorf("stacked %s: %w", s.entry.base(), err)
+		}
+		ids = append(ids, id)
+	}
 
-func (i *Importer) uploadAsset(ctx context.Context, filename string, content []byte, modTime time.Time) error {
-	// Create multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+	// A copy of a stack that was already created (e.g. in another album
+	// folder). A stack that failed before is created on the next run, when
+	// its members are duplicates.
+	if uploadState.Stacked(assetID) {
+		return assetID, fresh, nil
+	}
 
-	// Add asset data
-	part, err := writer.CreateFormFile("assetData", filename)
+	stackID, err := i.createStack(ctx, ids)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	if _, err := part.Write(content); err != nil {
-		return err
+	if stackID != "" {
+		uploadState.AddStack(assetID, stackID)
 	}
 
-	// Add device asset ID (for deduplication)
-	deviceAssetID := fmt.Sprintf("import-%x", content[:min(32, len(content))])
-	writer.WriteField("deviceAssetId", deviceAssetID)
-	writer.WriteField("deviceId", "immich-importer")
-	writer.WriteField("fileCreatedAt", modTime.Format(time.RFC3339))
-	writer.WriteField("fileModifiedAt", modTime.Format(time.RFC3339))
+	return assetID, fresh, nil
+}
 
-	writer.Close()
+// uploadOnce uploads an entry unless the same content was already uploaded
+// by this job, e.g. from another album folder, and records its asset ID in the
+// upload state. It returns the asset ID and whether the content was new.
+func (i *Importer) uploadOnce(ctx context.Context, e *entry, req *uploadRequest, uploadState *state.UploadState) (string, bool, error) {
+	sum := sha1.Sum(req.content)
+	hash := hex.EncodeToString(sum[:])
+	if id, ok := uploadState.AssetByHash(hash); ok {
+		// The first copy's record says whether the job created the asset
+		uploadState.RecordAsset(e.id(), state.AssetRecord{ID: id, Status: state.AssetDuplicate})
+		return id, false, nil
+	}
 
-	// Create request
-	url := fmt.Sprintf("%s/api/assets", i.serverURL)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, &buf)
+	result, err := i.uploadAsset(ctx, req)
 	if err != nil {
-		return err
+		return "", false, err
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("x-api-key", i.apiKey)
+	uploadState.RecordHash(hash, result.ID)
+	uploadState.RecordAsset(e.id(), state.AssetRecord{ID: result.ID, Status: result.Status})
+	return result.ID, true, nil
+}
+
+// createdByJob reports whether an entry just uploaded became a new asset. The
+// job tag and job album only get those, so they show what a rollback of the
+// job deletes; assets Immich had already keep the tags of their own job.
+func createdByJob(uploadState *state.UploadState, e *entry, fresh bool) bool {
+	if !fresh {
+		return false
+	}
+	record, ok := uploadState.Asset(e.id())
+	return ok && record.Status == state.AssetCreated
+}
 
-	// Send request
-	resp, err := i.httpClient.Do(req)
+// newUploadRequest reads an archive entry, its XMP sidecar and its Takeout
+// metadata for upload
+func newUploadRequest(e *entry, sidecar *entry, meta *takeoutMetadata) (*uploadRequest, error) {
+	// Read file content
+	content, err := readZipEntry(e.file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// Check response
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var errResp map[string]interface{}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			if msg, ok := errResp["message"].(string); ok {
-				// Duplicate is not an error
-				if strings.Contains(msg, "duplicate") {
-					return nil
-				}
-				return fmt.Errorf("upload failed: %s", msg)
-			}
+
+	req := &uploadRequest{filename: e.base(), content: content, metadata: meta}
+	if sidecar != nil {
+		if req.sidecar, err = readZipEntry(sidecar.file); err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("upload failed: %d %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	// See captureTime for the order of precedence
+	req.modTime, req.dateSource = captureTime(e, content, meta)
+	if req.modTime.IsZero() {
+		req.modTime = time.Now()
+	}
+
+	return req, nil
 }
 
-func isMediaFile(name string) bool {
-	ext := strings.ToLower(filepath.Ext(name))
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".heif", ".avif",
-		".mp4", ".mov", ".avi", ".mkv", ".webm", ".m4v", ".3gp",
-		".raw", ".cr2", ".nef", ".arw", ".dng", ".orf", ".rw2":
-		return true
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
 	}
-	return false
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// uploadRequest is a single asset upload
+type uploadRequest struct {
+	filename         string
+	content          []byte
+	modTime          time.Time
+	dateSource       dateSource
+	sidecar          []byte // XMP sidecar, optional
+	metadata         *takeoutMetadata
+	livePhotoVideoID string // ID of the already uploaded Live Photo video, optional
+	visibility       string // optional: "archive", "hidden" or "locked"
+	isFavorite       bool
+}
+
+// uploadAsset uploads one asset
+func (i *Importer) uploadAsset(ctx context.Context, r *uploadRequest) (*immich.UploadResult, error) {
+	// Attach the XMP sidecar from the archive, else one generated from the
+	// Takeout metadata
+	sidecar := r.sidecar
+	if sidecar == nil && r.metadata != nil {
+		sidecar = buildXMP(r.metadata)
+	}
+
+	return i.client.Upload(ctx, &immich.UploadRequest{
+		Filename: r.filename,
+		Content:  r.content,
+		// Device asset ID (for deduplication)
+		DeviceAssetID:    fmt.Sprintf("import-%x", r.content[:min(32, len(r.content))]),
+		DeviceID:         i.deviceID,
+		FileCreatedAt:    r.modTime,
+		FileModifiedAt:   r.modTime,
+		Sidecar:          sidecar,
+		LivePhotoVideoID: r.livePhotoVideoID,
+		Visibility:       r.visibility,
+		IsFavorite:       r.isFavorite,
+	})
 }
 
 // UploadFile uploads a single file to Immich
@@ -230,5 +571,10 @@ func (i *Importer) UploadFile(ctx context.Context, filePath string) error {
 		return err
 	}
 
-	return i.uploadAsset(ctx, filepath.Base(filePath), content, info.ModTime())
+	_, err = i.uploadAsset(ctx, &uploadRequest{
+		filename: filepath.Base(filePath),
+		content:  content,
+		modTime:  info.ModTime(),
+	})
+	return err
 }
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// entry is a file inside one of the downloaded archives
+type entry struct {
+	archive string // Drive ID of the archive
+	file    *zip.File
+	kind    mediaKind
+}
+
+// id identifies the entry in the upload state
+func (e *entry) id() string {
+	return state.EntryID(e.archive, e.file.Name)
+}
+
+// dir returns the folder of the entry inside the archive
+func (e *entry) dir() string {
+	return path.Dir(e.file.Name)
+}
+
+// base returns the file name of the entry
+func (e *entry) base() string {
+	return path.Base(e.file.Name)
+}
+
+// stemKey identifies an entry by folder and file name without extension,
+// case-insensitively. Multi-part Takeouts use the same folder names in every
+// part, so keys match across archives.
+func (e *entry) stemKey() string {
+	name := strings.ToLower(e.file.Name)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+func (e *entry) ext() string {
+	return strings.ToLower(path.Ext(e.file.Name))
+}
+
+// archiveIndex holds the entries of all downloaded archives of a job
+type archiveIndex struct {
+	readers  []*zip.ReadCloser
+	media    []*entry
+	sidecars map[string]*entry   // lower-case entry name -> XMP sidecar
+	metadata map[string][]*entry // lower-case folder -> Takeout JSON files
+	albums   map[string]string   // lower-case folder -> album name, see albumName
+}
+
+// openIndex opens every downloaded zip of the job and classifies its entries.
+// Unsupported entries are recorded in the report.
+func (i *Importer) openIndex(files []state.FileState) (*archiveIndex, error) {
+	idx := &archiveIndex{
+		sidecars: make(map[string]*entry),
+		metadata: make(map[string][]*entry),
+		albums:   make(map[string]string),
+	}
+
+	for _, file := range files {
+		if !file.Downloaded || file.LocalPath == "" {
+			continue
+		}
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".zip") {
+			continue
+		}
+
+		reader, err := zip.OpenReader(file.LocalPath)
+		if err != nil {
+			idx.Close()
+			return nil, fmt.Errorf("failed to open zip: %w", err)
+		}
+		idx.readers = append(idx.readers, reader)
+
+		for _, f := range reader.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			e := &entry{archive: file.DriveID, file: f, kind: i.classifier.classify(f.Name)}
+			switch {
+			case e.kind.isMedia():
+				idx.media = append(idx.media, e)
+			case e.kind == kindSidecar:
+				idx.sidecars[strings.ToLower(f.Name)] = e
+			case e.kind == kindMetadata:
+				dir := strings.ToLower(e.dir())
+				idx.metadata[dir] = append(idx.metadata[dir], e)
+			case e.kind == kindUnsupported:
+				i.report.addUnsupported(f.Name)
+			}
+		}
+	}
+
+	return idx, nil
+}
+
+// Close closes all archives
+func (idx *archiveIndex) Close() {
+	for _, r := range idx.readers {
+		r.Close()
+	}
+	idx.readers = nil
+}
+
+// sidecarFor returns the XMP sidecar for a media entry, named either
+// IMG_1.jpg.xmp or IMG_1.xmp
+func (idx *archiveIndex) sidecarFor(e *entry) *entry {
+	if s, ok := idx.sidecars[strings.ToLower(e.file.Name)+".xmp"]; ok {
+		return s
+	}
+	return idx.sidecars[e.stemKey()+".xmp"]
+}
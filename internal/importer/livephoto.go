@@ -0,0 +1,60 @@
+package importer
+
+import "fmt"
+
+// LivePhotoPolicy decides what happens to the video half of a Live Photo or
+// motion photo
+type LivePhotoPolicy string
+
+const (
+	// LivePhotoLink uploads the video as the still's live photo component
+	LivePhotoLink LivePhotoPolicy = "link"
+	// LivePhotoHide uploads the video hidden from the timeline, unlinked
+	LivePhotoHide LivePhotoPolicy = "hide"
+	// LivePhotoSeparate uploads still and video as unrelated assets
+	LivePhotoSeparate LivePhotoPolicy = "separate"
+)
+
+// ParseLivePhotoPolicy parses a --live-photos flag value
+func ParseLivePhotoPolicy(s string) (LivePhotoPolicy, error) {
+	switch p := LivePhotoPolicy(s); p {
+	case LivePhotoLink, LivePhotoHide, LivePhotoSeparate:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid live photo policy %q (want link, hide or separate)", s)
+}
+
+// Stills and videos that make up Live Photos (IMG_1234.HEIC + IMG_1234.MOV)
+// and older Pixel motion photos exported with their video
+// (MVIMG_20180101_120000.jpg + MVIMG_20180101_120000.mp4). Motion photos with
+// only an embedded video need nothing here; Immich extracts the video itself.
+var (
+	liveStillExts = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true}
+	liveVideoExts = map[string]bool{".mov": true, ".mp4": true}
+)
+
+// pairLivePhotos attaches each Live Photo video to the still with the same
+// folder and file name, removing the video from the asset list
+func pairLivePhotos(assets []*asset) []*asset {
+	stills := make(map[string]*asset)
+	for _, a := range assets {
+		if a.entry.kind == kindImage && liveStillExts[a.entry.ext()] {
+			if _, ok := stills[a.entry.stemKey()]; !ok {
+				stills[a.entry.stemKey()] = a
+			}
+		}
+	}
+
+	paired := assets[:0]
+	for _, a := range assets {
+		if a.entry.kind == kindVideo && liveVideoExts[a.entry.ext()] {
+			if still, ok := stills[a.entry.stemKey()]; ok && still.liveVideo == nil {
+				still.liveVideo = a.entry
+				continue
+			}
+		}
+		paired = append(paired, a)
+	}
+
+	return paired
+}
@@ -0,0 +1,137 @@
+package importer
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MediaTypes lists the file extensions (with leading dot) Immich accepts
+type MediaTypes struct {
+	Image   []string
+	Video   []string
+	Sidecar []string
+}
+
+// DefaultMediaTypes is a bundled copy of Immich's supported media types. It is
+// used when the server's list is not available, e.g. for offline dry runs.
+var DefaultMediaTypes = MediaTypes{
+	Image: []string{
+		".3fr", ".ari", ".arw", ".avif", ".bmp", ".cap", ".cin", ".cr2", ".cr3", ".crw",
+		".dcr", ".dng", ".erf", ".fff", ".gif", ".heic", ".heif", ".hif", ".iiq", ".insp",
+		".jp2", ".jpe", ".jpeg", ".jpg", ".jxl", ".k25", ".kdc", ".mrw", ".nef", ".nrw",
+		".orf", ".ori", ".pef", ".png", ".psd", ".raf", ".raw", ".rw2", ".rwl", ".sr2",
+		".srf", ".srw", ".svg", ".tif", ".tiff", ".webp", ".x3f",
+	},
+	Video: []string{
+		".3g2", ".3gp", ".3gpp", ".avi", ".flv", ".insv", ".m2t", ".m2ts", ".m4v", ".mkv",
+		".mov", ".mp4", ".mpe", ".mpeg", ".mpg", ".mts", ".vob", ".webm", ".wmv",
+	},
+	Sidecar: []string{".xmp"},
+}
+
+// mediaKind is how an archive entry is treated
+type mediaKind int
+
+const (
+	kindUnsupported mediaKind = iota
+	kindImage
+	kindVideo
+	kindSidecar
+	kindMetadata // Takeout JSON metadata, never reported as unsupported
+)
+
+// classifier maps lower-case extensions to their kind
+type classifier map[string]mediaKind
+
+func newClassifier(types MediaTypes) classifier {
+	c := make(classifier)
+	add := func(exts []string, kind mediaKind) {
+		for _, ext := range exts {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			c[ext] = kind
+		}
+	}
+	add(types.Image, kindImage)
+	add(types.Video, kindVideo)
+	add(types.Sidecar, kindSidecar)
+	return c
+}
+
+func (c classifier) classify(name string) mediaKind {
+	ext := strings.ToLower(filepath.Ext(name))
+	if kind, ok := c[ext]; ok {
+		return kind
+	}
+	if ext == ".json" {
+		return kindMetadata
+	}
+	return kindUnsupported
+}
+
+func (k mediaKind) isMedia() bool {
+	return k == kindImage || k == kindVideo
+}
+
+// Report summarizes archive entries that were not imported
+type Report struct {
+	// Unsupported maps a lower-case extension to the entries skipped because
+	// the server does not accept that file type
+	Unsupported map[string][]string
+
+	// Trashed lists entries from the Google Photos trash that were skipped
+	Trashed []string
+
+	// Undated lists uploaded entries whose capture date could not be
+	// determined, see captureTime
+	Undated []UndatedAsset
+}
+
+// UndatedAsset is an entry uploaded without a known capture date
+type UndatedAsset struct {
+	Name string
+	// Used is the date it was uploaded with: the zip modification time, or the
+	// time of the upload if the zip has none
+	Used time.Time
+}
+
+func newReport() *Report {
+	return &Report{Unsupported: make(map[string][]string)}
+}
+
+func (r *Report) addUnsupported(name string) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		ext = "(none)"
+	}
+	r.Unsupported[ext] = append(r.Unsupported[ext], name)
+}
+
+// UnsupportedCount returns the number of entries skipped as unsupported
+func (r *Report) UnsupportedCount() int {
+	n := 0
+	for _, names := range r.Unsupported {
+		n += len(names)
+	}
+	return n
+}
+
+// UnsupportedExtensions returns the skipped extensions, most frequent first
+func (r *Report) UnsupportedExtensions() []string {
+	exts := make([]string, 0, len(r.Unsupported))
+	for ext := range r.Unsupported {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(a, b int) bool {
+		na, nb := len(r.Unsupported[exts[a]]), len(r.Unsupported[exts[b]])
+		if na != nb {
+			return na > nb
+		}
+		return exts[a] < exts[b]
+	})
+	return exts
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/preflight"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// Number of assets deleted per request
+const rollbackBatchSize = 500
+
+// Permissions a rollback needs on the API key. Without asset.read, assets the
+// key may not delete cannot be told from ones already deleted.
+var rollbackPermissions = []string{"asset.read", "asset.delete", "album.delete", "tag.delete"}
+
+// Rollback deletes the assets, albums and job tag a job created. Assets go to the
+// Immich trash, or are deleted for good if force is set. Deleted items are
+// removed from the asset store as they go, so an interrupted rollback can be
+// run again. It returns the number of assets deleted.
+func (i *Importer) Rollback(ctx context.Context, jobState *state.JobState, force bool) (int, error) {
+	if jobState.UploadState == nil {
+		return 0, nil
+	}
+	if err := i.checkRollbackAccess(ctx, jobState); err != nil {
+		return 0, err
+	}
+	us, err := jobState.OpenUploadState()
+	if err != nil {
+		return 0, err
+	}
+	defer jobState.Close()
+
+	// Only with the owner known does a failed lookup mean an asset is gone
+	confirmGone := jobState.UserID != ""
+
+	deleted := 0
+	ids := us.CreatedAssetIDs()
+	for start := 0; start < len(ids); start += rollbackBatchSize {
+		batch := ids[start:min(start+rollbackBatchSize, len(ids))]
+
+		gone, err := i.deleteAssets(ctx, batch, force, confirmGone)
+		if forgetErr := jobState.ForgetAssets(gone); forgetErr != nil && err == nil {
+			err = forgetErr
+		}
+		deleted += len(gone)
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	// Albums are removed once their assets are gone
+	remaining := us.CreatedAlbums[:0]
+	for _, id := range us.CreatedAlbums {
+		if err := i.deleteAlbum(ctx, id, confirmGone); err != nil {
+			fmt.Printf("Warning: failed to delete album %s: %v\n", id, err)
+			remaining = append(remaining, id)
+		}
+	}
+	us.CreatedAlbums = remaining
+	if err := jobState.Save(); err != nil {
+		return deleted, err
+	}
+	if len(remaining) > 0 {
+		return deleted, fmt.Errorf("failed to delete %d album(s)", len(remaining))
+	}
+
+	// The job tag is only on assets the job created
+	if tagID := us.TagIDs[jobState.Tag]; jobState.Tag != "" && tagID != "" {
+		if err := i.deleteTag(ctx, tagID, confirmGone); err != nil {
+			return deleted, err
+		}
+		delete(us.TagIDs, jobState.Tag)
+		if err := jobState.Save(); err != nil {
+			return deleted, err
+		}
+	}
+	if len(us.CreatedAssetIDs()) > 0 {
+		return deleted, fmt.Errorf("%d asset(s) could not be deleted", len(us.CreatedAssetIDs()))
+	}
+
+	// Nothing of the job is left in Immich; a retry would upload it again
+	if err := jobState.ResetUploads(); err != nil {
+		return deleted, err
+	}
+	jobState.Status = "rolled-back"
+	return deleted, jobState.Save()
+}
+
+// checkRollbackAccess makes sure the API key belongs to the user the job
+// uploaded as and may delete what it created. Immich answers 400 both for
+// items that do not exist and for ones the key may not touch, so a rollback
+// with the wrong key would take everything for deleted already.
+func (i *Importer) checkRollbackAccess(ctx context.Context, jobState *state.JobState) error {
+	user, err := i.client.CurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read the Immich user: %w", err)
+	}
+	if jobState.UserID != "" && user.ID != jobState.UserID {
+		return fmt.Errorf("the job uploaded as another Immich user; roll it back with an API key of user %s", jobState.UserID)
+	}
+
+	permissions, err := i.client.APIKeyPermissions(ctx)
+	if code := immich.StatusCode(err); code == http.StatusNotFound || code == http.StatusMethodNotAllowed {
+		return nil // the server cannot tell
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read API key permissions: %w", err)
+	}
+	if missing := preflight.MissingPermissions(permissions, rollbackPermissions); len(missing) > 0 {
+		return fmt.Errorf("the API key lacks the %s permission(s) a rollback needs", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// deleteAssets deletes a batch of assets. If the batch is refused, e.g.
+// because some assets were already deleted by hand, the assets are deleted one
+// by one. It returns the IDs that are gone, including those that were
+// already, as far as confirmGone allows telling, see deleteAsset.
+func (i *Importer) deleteAssets(ctx context.Context, ids []string, force, confirmGone bool) ([]string, error) {
+	err := i.client.DeleteAssets(ctx, ids, force)
+	if err == nil {
+		return ids, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	if len(ids) == 1 {
+		if err := i.deleteAsset(ctx, ids[0], force, confirmGone); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+
+	var gone []string
+	for _, id := range ids {
+		if err := i.deleteAsset(ctx, id, force, confirmGone); err != nil {
+			if ctx.Err() != nil {
+				return gone, ctx.Err()
+			}
+			fmt.Printf("Warning: failed to delete asset %s: %v\n", id, err)
+			continue
+		}
+		gone = append(gone, id)
+	}
+	return gone, nil
+}
+
+// deleteAsset deletes one asset. A refused delete counts as done only if the
+// asset cannot be looked up either and confirmGone is set, i.e. the key is
+// known to belong to the asset's owner; otherwise it may just be out of reach.
+func (i *Importer) deleteAsset(ctx context.Context, id string, force, confirmGone bool) error {
+	err := i.client.DeleteAssets(ctx, []string{id}, force)
+	if err == nil || !immich.IsNotFound(err) || !confirmGone {
+		return err
+	}
+	if _, getErr := i.client.GetAsset(ctx, id); !immich.IsNotFound(getErr) {
+		return err
+	}
+	return nil // already deleted
+}
+
+// deleteTag and deleteAlbum take a refused delete for done, like deleteAsset,
+// only if confirmGone is set
+func (i *Importer) deleteTag(ctx context.Context, id string, confirmGone bool) error {
+	err := i.client.DeleteTag(ctx, id)
+	if err != nil && confirmGone && immich.IsNotFound(err) {
+		return nil // already deleted
+	}
+	return err
+}
+
+func (i *Importer) deleteAlbum(ctx context.Context, id string, confirmGone bool) error {
+	err := i.client.DeleteAlbum(ctx, id)
+	if err != nil && confirmGone && immich.IsNotFound(err) {
+		return nil // already deleted
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeoutMetadata is the Google Photos JSON sidecar of a media file
+type takeoutMetadata struct {
+	Title          string      `json:"title"`
+	Description    string      `json:"description"`
+	PhotoTakenTime takeoutTime `json:"photoTakenTime"`
+	CreationTime   takeoutTime `json:"creationTime"`
+	GeoData        geoData     `json:"geoData"`
+	GeoDataExif    geoData     `json:"geoDataExif"`
+	People         []struct {
+		Name string `json:"name"`
+	} `json:"people"`
+	Favorited bool `json:"favorited"`
+	Archived  bool `json:"archived"`
+	Trashed   bool `json:"trashed"`
+}
+
+// takeoutTime is a timestamp in Unix seconds, encoded as a string
+type takeoutTime struct {
+	Timestamp string `json:"timestamp"`
+}
+
+// Time returns the timestamp, or the zero time if it is missing
+func (t takeoutTime) Time() time.Time {
+	secs, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
+type geoData struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// takenAt returns when the photo was taken, or the zero time if unknown
+func (m *takeoutMetadata) takenAt() time.Time {
+	return m.PhotoTakenTime.Time()
+}
+
+// readMetadata parses a JSON sidecar entry
+func readMetadata(e *entry) (*takeoutMetadata, error) {
+	data, err := readZipEntry(e.file)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta takeoutMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Takeout cuts sidecar file names off at 47 (older exports) or 51 characters
+// including ".json", anywhere in the name, even inside the extension. Shorter
+// names are never truncated.
+const minTruncatedSidecar = 46
+
+// Google appends this before ".json" since 2024
+const supplementalSuffix = ".supplemental-metadata"
+
+// Duplicate names get a counter, which the sidecar carries after the
+// extension: IMG_1(1).jpg -> IMG_1.jpg(1).json
+var counterPattern = regexp.MustCompile(`^(.*)(\(\d+\))(\.[^.]*)$`)
+
+// findMetadata returns the JSON sidecar of a media entry from the same folder
+func (idx *archiveIndex) findMetadata(e *entry) *entry {
+	candidates := idx.metadata[strings.ToLower(e.dir())]
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	base := strings.ToLower(e.base())
+	counter := ""
+	if m := counterPattern.FindStringSubmatch(base); m != nil {
+		base, counter = m[1]+m[3], m[2]
+	}
+	stem := strings.TrimSuffix(base, path.Ext(base))
+
+	// Names the sidecar may have, without counter and ".json", best first
+	names := []string{base + supplementalSuffix, base, stem}
+
+	var truncated *entry
+	for _, j := range candidates {
+		name := strings.TrimSuffix(strings.ToLower(j.base()), ".json")
+		if counter != "" {
+			if !strings.HasSuffix(name, counter) {
+				continue
+			}
+			name = strings.TrimSuffix(name, counter)
+		}
+
+		for _, want := range names {
+			if name == want {
+				return j
+			}
+		}
+
+		// A cut-off name must be a prefix of the full sidecar name
+		if truncated == nil && len(j.base()) >= minTruncatedSidecar && strings.HasPrefix(names[0], name) {
+			truncated = j
+		}
+	}
+
+	return truncated
+}
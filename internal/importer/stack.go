@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Camera RAW formats that are stacked under a JPEG with the same name
+var rawExts = map[string]bool{
+	".3fr": true, ".ari": true, ".arw": true, ".cap": true, ".cr2": true, ".cr3": true,
+	".crw": true, ".dcr": true, ".dng": true, ".erf": true, ".fff": true, ".iiq": true,
+	".k25": true, ".kdc": true, ".mrw": true, ".nef": true, ".nrw": true, ".orf": true,
+	".ori": true, ".pef": true, ".raf": true, ".raw": true, ".rw2": true, ".rwl": true,
+	".sr2": true, ".srf": true, ".srw": true, ".x3f": true,
+}
+
+var jpegExts = map[string]bool{".jpg": true, ".jpeg": true}
+
+// Burst shots share a BURST id: 00000IMG_00000_BURST20190101123456789_COVER.jpg
+var burstPattern = regexp.MustCompile(`(?i)_BURST(\d+)`)
+
+// stackSiblings stacks RAW files under the JPEG with the same folder and name,
+// and the shots of a burst under its cover shot
+func stackSiblings(assets []*asset) []*asset {
+	stacked := make(map[*asset]bool)
+
+	// RAW+JPEG pairs
+	jpegs := make(map[string]*asset) // stem key -> top-level asset holding the JPEG
+	for _, a := range assets {
+		for _, member := range append([]*asset{a}, a.stack...) {
+			if _, ok := jpegs[member.entry.stemKey()]; !ok && jpegExts[member.entry.ext()] {
+				jpegs[member.entry.stemKey()] = a
+			}
+		}
+	}
+	for _, a := range assets {
+		if !rawExts[a.entry.ext()] {
+			continue
+		}
+		// The JPEG is the primary: it renders everywhere
+		if jpeg, ok := jpegs[a.entry.stemKey()]; ok {
+			addToStack(jpeg, a)
+			stacked[a] = true
+		}
+	}
+
+	// Bursts, grouped per folder and burst id
+	bursts := make(map[string][]*asset)
+	var burstKeys []string
+	for _, a := range assets {
+		if stacked[a] {
+			continue
+		}
+		m := burstPattern.FindStringSubmatch(a.entry.base())
+		if m == nil {
+			continue
+		}
+		key := strings.ToLower(a.entry.dir()) + "/" + m[1]
+		if _, ok := bursts[key]; !ok {
+			burstKeys = append(burstKeys, key)
+		}
+		bursts[key] = append(bursts[key], a)
+	}
+	for _, key := range burstKeys {
+		shots := bursts[key]
+		if len(shots) < 2 {
+			continue
+		}
+		// Cover shot first, then in shooting order
+		sort.Slice(shots, func(x, y int) bool {
+			if cx, cy := isBurstCover(shots[x]), isBurstCover(shots[y]); cx != cy {
+				return cx
+			}
+			return shots[x].entry.base() < shots[y].entry.base()
+		})
+		for _, shot := range shots[1:] {
+			addToStack(shots[0], shot)
+			stacked[shot] = true
+		}
+	}
+
+	kept := assets[:0]
+	for _, a := range assets {
+		if !stacked[a] {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+func isBurstCover(a *asset) bool {
+	return strings.Contains(strings.ToUpper(a.entry.base()), "_COVER")
+}
+
+// addToStack puts member, and anything already stacked under it, under
+// primary. Immich stacks are flat.
+func addToStack(primary, member *asset) {
+	primary.stack = append(primary.stack, member)
+	primary.stack = append(primary.stack, member.stack...)
+	member.stack = nil
+}
+
+// createStack stacks assets in Immich. The first ID is the primary asset.
+// Missing IDs (duplicates the server did not identify) are left out.
+func (i *Importer) createStack(ctx context.Context, assetIDs []string) (string, error) {
+	var ids []string
+	for _, id := range assetIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return "", nil
+	}
+
+	stack, err := i.client.CreateStack(ctx, ids)
+	if err != nil {
+		return "", err
+	}
+	return stack.ID, nil
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"archive/zip"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAssets builds an asset for each file name, as the index would for an
+// archive with these entries
+func testAssets(names ...string) []*asset {
+	var assets []*asset
+	for _, name := range names {
+		kind := kindImage
+		switch strings.ToLower(path.Ext(name)) {
+		case ".mp4", ".mov":
+			kind = kindVideo
+		}
+		e := &entry{archive: "drive-1", file: &zip.File{FileHeader: zip.FileHeader{Name: name}}, kind: kind}
+		assets = append(assets, &asset{entry: e})
+	}
+	return assets
+}
+
+// layout describes top-level assets as "primary: member, member"
+func layout(assets []*asset) []string {
+	var out []string
+	for _, a := range assets {
+		s := a.entry.base()
+		if len(a.stack) > 0 {
+			var members []string
+			for _, m := range a.stack {
+				members = append(members, m.entry.base())
+			}
+			s += ": " + strings.Join(members, ", ")
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestStackSiblings(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{
+			"raw+jpeg",
+			[]string{"P/IMG_1.CR2", "P/IMG_1.JPG", "P/IMG_2.jpg"},
+			[]string{"IMG_1.JPG: IMG_1.CR2", "IMG_2.jpg"},
+		},
+		{
+			"raw+jpeg in different case",
+			[]string{"P/dsc_1.jpeg", "P/DSC_1.NEF"},
+			[]string{"dsc_1.jpeg: DSC_1.NEF"},
+		},
+		{
+			"raw in another folder",
+			[]string{"A/IMG_1.jpg", "B/IMG_1.dng"},
+			[]string{"IMG_1.jpg", "IMG_1.dng"},
+		},
+		{
+			"raw without jpeg",
+			[]string{"P/IMG_1.ARW", "P/IMG_1.heic"},
+			[]string{"IMG_1.ARW", "IMG_1.heic"},
+		},
+		{
+			"burst with cover",
+			[]string{
+				"P/00001IMG_00001_BURST20190101123456789.jpg",
+				"P/00002IMG_00002_BURST20190101123456789.jpg",
+				"P/00000IMG_00000_BURST20190101123456789_COVER.jpg",
+			},
+			[]string{"00000IMG_00000_BURST20190101123456789_COVER.jpg: 00001IMG_00001_BURST20190101123456789.jpg, 00002IMG_00002_BURST20190101123456789.jpg"},
+		},
+		{
+			"burst without cover",
+			[]string{"P/IMG_0002_BURST42.jpg", "P/IMG_0001_BURST42.jpg", "P/IMG_0003_BURST42.jpg"},
+			[]string{"IMG_0001_BURST42.jpg: IMG_0002_BURST42.jpg, IMG_0003_BURST42.jpg"},
+		},
+		{
+			"single burst shot",
+			[]string{"P/IMG_0001_BURST42_COVER.jpg"},
+			[]string{"IMG_0001_BURST42_COVER.jpg"},
+		},
+		{
+			"bursts in different folders",
+			[]string{"A/IMG_0001_BURST42.jpg", "B/IMG_0002_BURST42.jpg"},
+			[]string{"IMG_0001_BURST42.jpg", "IMG_0002_BURST42.jpg"},
+		},
+		{
+			"different bursts",
+			[]string{"P/IMG_0001_BURST1.jpg", "P/IMG_0002_BURST2.jpg"},
+			[]string{"IMG_0001_BURST1.jpg", "IMG_0002_BURST2.jpg"},
+		},
+		{
+			"raw of a burst cover",
+			[]string{"P/IMG_0001_BURST42_COVER.jpg", "P/IMG_0001_BURST42_COVER.dng", "P/IMG_0002_BURST42.jpg"},
+			[]string{"IMG_0001_BURST42_COVER.jpg: IMG_0001_BURST42_COVER.dng, IMG_0002_BURST42.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := layout(stackSiblings(testAssets(tt.files...)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stackSiblings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
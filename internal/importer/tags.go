@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// DefaultPeopleTagPrefix is the parent tag of the people tags, e.g. People/Alice
+const DefaultPeopleTagPrefix = "People"
+
+// peopleTags returns the tags for the people named in an asset's metadata
+func (i *Importer) peopleTags(a *asset) []string {
+	if i.options.NoPeopleTags || a.metadata == nil {
+		return nil
+	}
+
+	var tags []string
+	for _, name := range a.metadata.peopleNames() {
+		// A slash would nest the tag another level
+		name = strings.TrimSpace(strings.ReplaceAll(name, "/", "-"))
+		if name == "" {
+			continue
+		}
+		tags = append(tags, strings.TrimSuffix(i.options.PeopleTagPrefix, "/")+"/"+name)
+	}
+	return tags
+}
+
+// queueTag remembers to tag an asset on the next flush
+func queueTag(uploadState *state.UploadState, tag, assetID string) {
+	if tag == "" || assetID == "" {
+		return
+	}
+	uploadState.QueueTag(tag, assetID)
+}
+
+// flushTags tags the queued assets, creating tags as needed
+func (i *Importer) flushTags(ctx context.Context, uploadState *state.UploadState) error {
+	for tag, assetIDs := range uploadState.PendingTags {
+		tagID, err := i.tagID(ctx, uploadState, tag)
+		if err != nil {
+			return err
+		}
+		if err := i.tagAssets(ctx, tagID, assetIDs); err != nil {
+			return fmt.Errorf("tag %q: %w", tag, err)
+		}
+		delete(uploadState.PendingTags, tag)
+	}
+	return nil
+}
+
+// tagID returns the ID of a tag such as "People/Alice". Immich creates the
+// tag and its parents if they do not exist yet, and returns the existing ones
+// otherwise.
+func (i *Importer) tagID(ctx context.Context, uploadState *state.UploadState, tag string) (string, error) {
+	if id, ok := uploadState.TagIDs[tag]; ok {
+		return id, nil
+	}
+
+	tags, err := i.client.UpsertTags(ctx, []string{tag})
+	if err != nil {
+		return "", fmt.Errorf("tag %q: %w", tag, err)
+	}
+	if len(tags) == 0 {
+		return "", fmt.Errorf("failed to create tag %q: empty response", tag)
+	}
+
+	if uploadState.TagIDs == nil {
+		uploadState.TagIDs = make(map[string]string)
+	}
+	uploadState.TagIDs[tag] = tags[0].ID
+	return tags[0].ID, nil
+}
+
+// tagAssets tags assets. Assets that already have the tag are not an error.
+func (i *Importer) tagAssets(ctx context.Context, tagID string, assetIDs []string) error {
+	results, err := i.client.TagAssets(ctx, tagID, assetIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if !r.Success && r.Error != immich.BulkErrorDuplicate {
+			fmt.Printf("Warning: could not tag asset %s: %s\n", r.ID, r.Error)
+		}
+	}
+	return nil
+}
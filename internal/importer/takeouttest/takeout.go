@@ -0,0 +1,262 @@
+// Package takeouttest builds synthetic Google Photos Takeout archives for
+// tests. The archives reproduce the quirks of real exports: photos repeated in
+// album and year folders, JSON sidecars with cut-off names, "-edited" copies
+// without a sidecar of their own, Live Photo pairs, sidecars that end up in a
+// different part than their photo, and files that are not media at all.
+package takeouttest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Root is the folder every Google Photos file is in
+const Root = "Takeout/Google Photos"
+
+// Takeout sidecar names are cut off at 51 characters including ".json"
+const maxSidecarName = 51
+
+// Item is a media file in the Takeout
+type Item struct {
+	Folder string // folder under Root, e.g. "Photos from 2019" or an album name
+	Name   string
+	Taken  time.Time
+
+	Description string
+	People      []string
+	Favorite    bool
+	Latitude    float64
+	Longitude   float64
+
+	// NoSidecar leaves out the JSON sidecar, as Takeout does for "-edited"
+	// copies and the video half of Live Photos
+	NoSidecar bool
+
+	Content []byte
+}
+
+// Path returns the path of the item inside the archive
+func (it *Item) Path() string {
+	return path.Join(Root, it.Folder, it.Name)
+}
+
+// SidecarPath returns the path of the JSON sidecar, cut off like Takeout does
+// for long file names
+func (it *Item) SidecarPath() string {
+	name := it.Name + ".supplemental-metadata"
+	if len(name)+len(".json") > maxSidecarName {
+		name = name[:maxSidecarName-len(".json")]
+	}
+	return path.Join(Root, it.Folder, name+".json")
+}
+
+// Takeout is a Google Photos export under construction
+type Takeout struct {
+	Items []*Item
+
+	// Albums maps album folders to their titles, written to metadata.json
+	Albums map[string]string
+
+	// Other holds files that are not media, by path inside the archive
+	Other map[string][]byte
+
+	// SplitSidecars puts each JSON sidecar in the part after its photo
+	SplitSidecars bool
+}
+
+// New returns a Takeout with the files every export has besides the media
+func New() *Takeout {
+	return &Takeout{
+		Albums: make(map[string]string),
+		Other: map[string][]byte{
+			"Takeout/archive_browser.html":                          []byte("<html><body>Archive browser</body></html>"),
+			Root + "/print-subscriptions.json":                      []byte("[]"),
+			Root + "/shared_album_comments.json":                    []byte("[]"),
+			Root + "/user-generated-memory-titles.json":             []byte(`{"title":[]}`),
+			Root + "/Photos from 2019/desktop.ini":                  []byte("[.ShellClassInfo]\r\n"),
+			Root + "/Photos from 2019/Thumbs.db":                    {0xd0, 0xcf, 0x11, 0xe0},
+			Root + "/Failed Videos/Failed video upload details.txt": []byte("Some videos could not be processed."),
+		},
+	}
+}
+
+// AddPhoto adds a photo to a folder under Root. Its content is unique to it.
+func (t *Takeout) AddPhoto(folder, name string, taken time.Time) *Item {
+	it := &Item{Folder: folder, Name: name, Taken: taken}
+	it.Content = content(it)
+	t.Items = append(t.Items, it)
+	return it
+}
+
+// AddToAlbum adds a copy of an item to an album folder, the way Takeout repeats
+// album photos outside their "Photos from" folder
+func (t *Takeout) AddToAlbum(it *Item, album string) *Item {
+	if _, ok := t.Albums[album]; !ok {
+		t.Albums[album] = album
+	}
+	c := *it
+	c.Folder = album
+	t.Items = append(t.Items, &c)
+	return &c
+}
+
+// AddEdited adds the "-edited" copy Google Photos keeps of an edited photo.
+// Like in real exports, it has no sidecar of its own.
+func (t *Takeout) AddEdited(it *Item) *Item {
+	ext := path.Ext(it.Name)
+	edited := &Item{
+		Folder:    it.Folder,
+		Name:      strings.TrimSuffix(it.Name, ext) + "-edited" + ext,
+		Taken:     it.Taken,
+		NoSidecar: true,
+	}
+	edited.Content = content(edited)
+	t.Items = append(t.Items, edited)
+	return edited
+}
+
+// AddLivePhoto adds a Live Photo: a HEIC still with a sidecar, and the MP4
+// video with the same name and none
+func (t *Takeout) AddLivePhoto(folder, stem string, taken time.Time) (still, video *Item) {
+	still = t.AddPhoto(folder, stem+".HEIC", taken)
+	video = t.AddPhoto(folder, stem+".MP4", taken)
+	video.NoSidecar = true
+	return still, video
+}
+
+// file is an entry of an archive
+type file struct {
+	path    string
+	content []byte
+}
+
+// Parts returns the export as numbered zip archives. Items are spread over
+// the parts in turn; the files that are not media go in the first part and the
+// album metadata in the last.
+func (t *Takeout) Parts(n int) ([][]byte, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("need at least one part, got %d", n)
+	}
+	parts := make([][]file, n)
+
+	for i, it := range t.Items {
+		part := i % n
+		parts[part] = append(parts[part], file{it.Path(), it.Content})
+		if it.NoSidecar {
+			continue
+		}
+
+		sidecar, err := metadata(it)
+		if err != nil {
+			return nil, err
+		}
+		if t.SplitSidecars {
+			part = (part + 1) % n
+		}
+		parts[part] = append(parts[part], file{it.SidecarPath(), sidecar})
+	}
+
+	for p, content := range t.Other {
+		parts[0] = append(parts[0], file{p, content})
+	}
+	for folder, title := range t.Albums {
+		data, err := json.Marshal(map[string]interface{}{
+			"title":       title,
+			"description": "",
+			"access":      "protected",
+			"date":        map[string]string{"timestamp": "1546300800", "formatted": "Jan 1, 2019, 12:00:00 AM UTC"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts[n-1] = append(parts[n-1], file{path.Join(Root, folder, "metadata.json"), data})
+	}
+
+	zips := make([][]byte, n)
+	for i, files := range parts {
+		data, err := writeZip(files)
+		if err != nil {
+			return nil, err
+		}
+		zips[i] = data
+	}
+	return zips, nil
+}
+
+// PartName returns the file name Takeout gives the i-th part, counting from 0
+func PartName(i int) string {
+	return fmt.Sprintf("takeout-20240115T101010Z-%03d.zip", i+1)
+}
+
+func writeZip(files []file) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	modified := time.Date(2024, 1, 15, 10, 10, 10, 0, time.UTC)
+	for _, f := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: f.path, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// metadata returns the JSON sidecar of an item
+func metadata(it *Item) ([]byte, error) {
+	timestamp := func(t time.Time) map[string]string {
+		return map[string]string{
+			"timestamp": strconv.FormatInt(t.Unix(), 10),
+			"formatted": t.UTC().Format("Jan 2, 2006, 3:04:05 PM UTC"),
+		}
+	}
+	geo := map[string]float64{"latitude": it.Latitude, "longitude": it.Longitude, "altitude": 0}
+	people := []map[string]string{}
+	for _, name := range it.People {
+		people = append(people, map[string]string{"name": name})
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"title":          it.Name,
+		"description":    it.Description,
+		"imageViews":     "0",
+		"creationTime":   timestamp(it.Taken.Add(time.Hour)),
+		"photoTakenTime": timestamp(it.Taken),
+		"geoData":        geo,
+		"geoDataExif":    geo,
+		"people":         people,
+		"favorited":      it.Favorite,
+		"url":            "https://photos.google.com/photo/" + it.Name,
+		"googlePhotosOrigin": map[string]interface{}{
+			"mobileUpload": map[string]string{"deviceType": "ANDROID_PHONE"},
+		},
+	}, "", "  ")
+}
+
+// content returns file content that starts like the item's file type and is
+// unique to its name, so each item is a separate asset in Immich
+func content(it *Item) []byte {
+	var header string
+	switch strings.ToLower(path.Ext(it.Name)) {
+	case ".mp4", ".mov":
+		header = "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+	case ".heic":
+		header = "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"
+	case ".png":
+		header = "\x89PNG\r\n\x1a\n"
+	default:
+		header = "\xff\xd8\xff\xdb"
+	}
+	return []byte(header + path.Join(it.Folder, it.Name))
+}
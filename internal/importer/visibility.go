@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// TrashPolicy decides what happens to items from the Google Photos trash
+type TrashPolicy string
+
+const (
+	// TrashSkip does not import trashed items
+	TrashSkip TrashPolicy = "skip"
+	// TrashImport uploads trashed items and moves them to the Immich trash
+	TrashImport TrashPolicy = "trash"
+)
+
+// ParseTrashPolicy parses a --trashed flag value
+func ParseTrashPolicy(s string) (TrashPolicy, error) {
+	switch p := TrashPolicy(s); p {
+	case TrashSkip, TrashImport:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid trash policy %q (want skip or trash)", s)
+}
+
+// Folder names Takeout uses for the trash and the Locked Folder, directly
+// under the Google Photos folder
+var (
+	trashFolders  = map[string]bool{"trash": true, "bin": true, "papierkorb": true, "corbeille": true, "papelera": true}
+	lockedFolders = map[string]bool{"locked folder": true}
+)
+
+// Names of the Google Photos folder in Takeout, depending on the account language
+var photosFolders = map[string]bool{"google photos": true, "google fotos": true}
+
+// inFolder reports whether the entry is in one of the named folders directly
+// under Takeout/Google Photos. Albums of the same name elsewhere do not
+// count; trashed items in them are found by their sidecar.
+func inFolder(e *entry, names map[string]bool) bool {
+	parts := strings.Split(strings.ToLower(e.dir()), "/")
+	for n := 0; n+1 < len(parts); n++ {
+		if photosFolders[parts[n]] {
+			return names[parts[n+1]]
+		}
+	}
+	return false
+}
+
+// classifyVisibility sets where Google Photos kept the asset. A stack or
+// Live Photo follows its primary asset.
+func classifyVisibility(a *asset) {
+	a.trashed = inFolder(a.entry, trashFolders) || (a.metadata != nil && a.metadata.Trashed)
+	a.locked = inFolder(a.entry, lockedFolders)
+	for _, s := range a.stack {
+		s.metadata = coalesceMetadata(s.metadata, a.metadata)
+		s.trashed, s.locked = a.trashed, a.locked
+	}
+}
+
+func coalesceMetadata(meta, fallback *takeoutMetadata) *takeoutMetadata {
+	if meta != nil {
+		return meta
+	}
+	return fallback
+}
+
+// visibility returns the Immich visibility for the asset, empty for the timeline
+func (a *asset) visibility() string {
+	switch {
+	case a.locked:
+		return "locked"
+	case a.metadata != nil && a.metadata.Archived:
+		return "archive"
+	}
+	return ""
+}
+
+// applyTrashPolicy classifies the assets and drops trashed ones unless they
+// are to be imported into the Immich trash
+func (i *Importer) applyTrashPolicy(assets []*asset) []*asset {
+	kept := assets[:0]
+	for _, a := range assets {
+		classifyVisibility(a)
+		if a.trashed && i.options.Trashed == TrashSkip {
+			i.report.Trashed = append(i.report.Trashed, a.entry.file.Name)
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// flushTrash moves the queued assets to the Immich trash. They stay queued
+// until that succeeds.
+func (i *Importer) flushTrash(ctx context.Context, uploadState *state.UploadState) error {
+	if len(uploadState.PendingTrash) == 0 {
+		return nil
+	}
+	if err := i.client.DeleteAssets(ctx, uploadState.PendingTrash, false); err != nil {
+		return fmt.Errorf("failed to move to trash: %w", err)
+	}
+	uploadState.PendingTrash = nil
+	return nil
+}
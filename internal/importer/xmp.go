@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+)
+
+// Rating given to Google Photos favorites
+const favoriteRating = 5
+
+// buildXMP writes the Takeout metadata as an XMP sidecar, so it survives
+// Immich re-reading the file's metadata. It returns nil if there is nothing
+// to write.
+func buildXMP(meta *takeoutMetadata) []byte {
+	var attrs, elems bytes.Buffer
+
+	// Takeout timestamps are UTC; the offset makes that explicit
+	if t := meta.takenAt(); !t.IsZero() {
+		date := t.Format("2006-01-02T15:04:05-07:00")
+		writeAttr(&attrs, "exif:DateTimeOriginal", date)
+		writeAttr(&attrs, "photoshop:DateCreated", date)
+	}
+
+	if geo, ok := meta.location(); ok {
+		writeAttr(&attrs, "exif:GPSLatitude", gpsCoordinate(geo.Latitude, "N", "S"))
+		writeAttr(&attrs, "exif:GPSLongitude", gpsCoordinate(geo.Longitude, "E", "W"))
+		if geo.Altitude != 0 {
+			ref := "0"
+			if geo.Altitude < 0 {
+				ref = "1" // below sea level
+			}
+			writeAttr(&attrs, "exif:GPSAltitude", fmt.Sprintf("%d/100", int64(math.Round(math.Abs(geo.Altitude)*100))))
+			writeAttr(&attrs, "exif:GPSAltitudeRef", ref)
+		}
+	}
+
+	if meta.Favorited {
+		writeAttr(&attrs, "xmp:Rating", fmt.Sprint(favoriteRating))
+	}
+
+	if meta.Description != "" {
+		elems.WriteString("   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+		xml.EscapeText(&elems, []byte(meta.Description))
+		elems.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+	}
+
+	if names := meta.peopleNames(); len(names) > 0 {
+		elems.WriteString("   <dc:subject><rdf:Bag>")
+		for _, name := range names {
+			elems.WriteString("<rdf:li>")
+			xml.EscapeText(&elems, []byte(name))
+			elems.WriteString("</rdf:li>")
+		}
+		elems.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+
+	if attrs.Len() == 0 && elems.Len() == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	b.WriteString("    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"\n")
+	b.WriteString("    xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\"\n")
+	b.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"")
+	b.Write(attrs.Bytes())
+	b.WriteString(">\n")
+	b.Write(elems.Bytes())
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>\n")
+	return b.Bytes()
+}
+
+func writeAttr(b *bytes.Buffer, name, value string) {
+	fmt.Fprintf(b, "\n    %s=\"", name)
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("\"")
+}
+
+// gpsCoordinate formats a coordinate the way XMP stores it: "52,30.1234N"
+func gpsCoordinate(value float64, positive, negative string) string {
+	ref := positive
+	if value < 0 {
+		ref, value = negative, -value
+	}
+	degrees := math.Floor(value)
+	minutes := (value - degrees) * 60
+	return fmt.Sprintf("%d,%.6f%s", int(degrees), minutes, ref)
+}
+
+// location returns where the photo was taken. Google keeps the location set
+// in Google Photos in geoData and the camera's in geoDataExif; 0,0 means none.
+func (m *takeoutMetadata) location() (geoData, bool) {
+	for _, geo := range []geoData{m.GeoData, m.GeoDataExif} {
+		if geo.Latitude != 0 || geo.Longitude != 0 {
+			return geo, true
+		}
+	}
+	return geoData{}, false
+}
+
+// peopleNames returns the names of the people tagged in the photo
+func (m *takeoutMetadata) peopleNames() []string {
+	var names []string
+	for _, p := range m.People {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
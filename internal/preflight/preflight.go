@@ -0,0 +1,251 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/config"
+	"github.com/davidaniva/immich-importer/internal/immich"
+)
+
+// Permissions every import needs on its API key. Options that tag, stack or
+// trash assets need more, see importer.Options.Permissions.
+var requiredPermissions = []string{
+	"asset.upload",
+	"album.read",
+	"album.create",
+	"albumAsset.create",
+	"user.read",
+}
+
+// minVersion is the oldest Immich release the importer works with. Older
+// releases ignore the upload visibility field, so archived, hidden and Locked
+// Folder items would land on the timeline, and v1.133 added the Locked Folder.
+var minVersion = Version{Major: 1, Minor: 133, Patch: 0}
+
+// Version is an Immich server version
+type Version = immich.Version
+
+// MediaTypes lists the file extensions the server accepts
+type MediaTypes = immich.MediaTypes
+
+// Result describes a server that passed the preflight checks
+type Result struct {
+	ServerURL   string
+	Version     Version
+	MediaTypes  MediaTypes
+	Permissions []string
+}
+
+// Error is a failed preflight check together with advice on how to fix it
+type Error struct {
+	Check string
+	Err   error
+	Hint  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Check, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// NormalizeURL cleans up a server URL as typed by the user: it adds a missing
+// scheme and removes trailing slashes, an /api suffix, query and fragment
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("server URL is empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid server URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q: missing host", raw)
+	}
+
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.Path = strings.TrimSuffix(u.Path, "/api")
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// wellKnown is the response from /.well-known/immich
+type wellKnown struct {
+	API struct {
+		Endpoint string `json:"endpoint"`
+	} `json:"api"`
+}
+
+// Discover normalizes a server URL and follows /.well-known/immich (and any
+// redirects) to the URL the API is served under. The returned URL is the base
+// that "/api/..." paths are appended to.
+func Discover(ctx context.Context, raw string) (string, error) {
+	base, err := NormalizeURL(raw)
+	if err != nil {
+		return "", &Error{Check: "server URL", Err: err, Hint: "Use the address you open Immich with in the browser, e.g. https://photos.example.com"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/.well-known/immich", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", &Error{Check: "connect to server", Err: err, Hint: "Check that the server URL is correct and reachable from this computer"}
+	}
+	defer resp.Body.Close()
+
+	// Not every reverse proxy serves the well-known document; use the URL as typed
+	if resp.StatusCode != http.StatusOK {
+		return base, nil
+	}
+
+	var doc wellKnown
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || doc.API.Endpoint == "" {
+		return base, nil
+	}
+
+	// The endpoint may be relative to the (possibly redirected) document URL
+	endpoint, err := resp.Request.URL.Parse(doc.API.Endpoint)
+	if err != nil {
+		return base, nil
+	}
+	return NormalizeURL(endpoint.String())
+}
+
+// Run checks that the server is reachable and compatible and that the API key
+// can upload assets and manage albums, and has the extra permissions given
+func Run(ctx context.Context, serverURL, apiKey string, extra []string) (*Result, error) {
+	result := &Result{ServerURL: serverURL}
+	client := immich.New(serverURL, apiKey)
+	client.HTTPClient = httpClient
+
+	// Ping
+	if err := client.Ping(ctx); err != nil {
+		return nil, &Error{
+			Check: "ping server",
+			Err:   err,
+			Hint:  fmt.Sprintf("%s does not look like an Immich server. Check the URL, or that the server is running", serverURL),
+		}
+	}
+
+	// Version
+	var err error
+	if result.Version, err = client.Version(ctx); err != nil {
+		return nil, &Error{Check: "read server version", Err: err, Hint: "Check that the server is running a supported Immich release"}
+	}
+	if result.Version.Less(minVersion) {
+		return nil, &Error{
+			Check: "server version",
+			Err:   fmt.Errorf("Immich %s is too old", result.Version),
+			Hint:  fmt.Sprintf("Upgrade Immich to %s or newer", minVersion),
+		}
+	}
+
+	// Supported media types
+	if result.MediaTypes, err = client.MediaTypes(ctx); err != nil {
+		return nil, &Error{Check: "read supported media types", Err: err, Hint: "Check that the server is running a supported Immich release"}
+	}
+
+	// API key permissions
+	permissions, err := apiKeyPermissions(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	result.Permissions = permissions
+
+	required := append(append([]string{}, requiredPermissions...), extra...)
+	if missing := MissingPermissions(permissions, required); len(missing) > 0 {
+		return nil, &Error{
+			Check: "API key permissions",
+			Err:   fmt.Errorf("missing %s", strings.Join(missing, ", ")),
+			Hint:  "Create a new API key in Immich (User Settings > API Keys) with these permissions, then " + replaceKeyHint(),
+		}
+	}
+
+	return result, nil
+}
+
+// apiKeyPermissions returns the permissions of the API key. Servers without
+// /api/api-keys/me only get the key validated, and nil is returned.
+func apiKeyPermissions(ctx context.Context, client *immich.Client) ([]string, error) {
+	permissions, err := client.APIKeyPermissions(ctx)
+	if err == nil {
+		return permissions, nil
+	}
+
+	if code := immich.StatusCode(err); code == http.StatusNotFound || code == http.StatusMethodNotAllowed {
+		// Older server: at least check that the key is accepted
+		_, err = client.CurrentUser(ctx)
+		if err == nil {
+			return nil, nil
+		}
+	}
+
+	if immich.IsUnauthorized(err) {
+		return nil, &Error{
+			Check: "API key",
+			Err:   err,
+			Hint:  "The API key was rejected. It may have been deleted in Immich; create a new one, then " + replaceKeyHint(),
+		}
+	}
+	return nil, &Error{Check: "API key", Err: err, Hint: "Check that the server is running a supported Immich release"}
+}
+
+// replaceKeyHint says how to replace the stored API key. The key is part of
+// the config, so the config is set up again from scratch.
+func replaceKeyHint() string {
+	path, err := config.GetConfigPath()
+	if err != nil {
+		path = "config.json"
+	}
+	return fmt.Sprintf("delete %s and set up again with 'immich-importer --server URL --api-key KEY' (or --token TOKEN)", path)
+}
+
+// MissingPermissions returns the required permissions not in granted. A nil
+// list means the server cannot report permissions, and nothing is missing.
+func MissingPermissions(granted, required []string) []string {
+	if granted == nil {
+		return nil
+	}
+
+	have := make(map[string]bool)
+	for _, p := range granted {
+		have[p] = true
+	}
+	if have["all"] {
+		return nil
+	}
+
+	var missing []string
+	for _, p := range required {
+		if !have[p] && !slices.Contains(missing, p) {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
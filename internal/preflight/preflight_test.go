@@ -0,0 +1,153 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/immich/immichtest"
+)
+
+func TestRunChecksPermissions(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	srv.Permissions = []string{"asset.upload", "album.read", "album.create", "albumAsset.create", "user.read", "tag.create"}
+
+	if _, err := Run(context.Background(), srv.URL, srv.APIKey, nil); err != nil {
+		t.Fatalf("Run without extra permissions: %v", err)
+	}
+
+	_, err := Run(context.Background(), srv.URL, srv.APIKey, []string{"tag.create", "tag.asset", "stack.create"})
+	var preflightErr *Error
+	if !errors.As(err, &preflightErr) || preflightErr.Check != "API key permissions" {
+		t.Fatalf("Run with missing permissions returned %v", err)
+	}
+	if got, want := preflightErr.Err.Error(), "missing tag.asset, stack.create"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestRunRefusesOldServer(t *testing.T) {
+	srv := immichtest.NewServer(t)
+	srv.Version = immich.Version{Major: 1, Minor: 132, Patch: 2}
+
+	_, err := Run(context.Background(), srv.URL, srv.APIKey, nil)
+	var preflightErr *Error
+	if !errors.As(err, &preflightErr) || preflightErr.Check != "server version" {
+		t.Fatalf("Run against Immich %s returned %v", srv.Version, err)
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	required := []string{"asset.upload", "tag.create", "asset.upload"}
+	tests := []struct {
+		name    string
+		granted []string
+		want    []string
+	}{
+		{"not reported", nil, nil},
+		{"all", []string{"all"}, nil},
+		{"some", []string{"tag.create"}, []string{"asset.upload"}},
+		{"none", []string{}, []string{"asset.upload", "tag.create"}},
+	}
+	for _, tt := range tests {
+		if got := MissingPermissions(tt.granted, required); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: MissingPermissions = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://photos.example.com", "https://photos.example.com"},
+		{"https://photos.example.com/", "https://photos.example.com"},
+		{"https://photos.example.com//", "https://photos.example.com"},
+		{"https://photos.example.com/api", "https://photos.example.com"},
+		{"https://photos.example.com/api/", "https://photos.example.com"},
+		{"https://example.com/immich/api", "https://example.com/immich"},
+		{"https://example.com/apis", "https://example.com/apis"},
+		{"photos.example.com", "https://photos.example.com"},
+		{"  photos.example.com:2283/  ", "https://photos.example.com:2283"},
+		{"http://192.168.1.10:2283", "http://192.168.1.10:2283"},
+		{"https://photos.example.com/?apiKey=secret", "https://photos.example.com"},
+		{"https://photos.example.com/photos#/albums", "https://photos.example.com/photos"},
+		{"https://photos.example.com/api?x=1#top", "https://photos.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := NormalizeURL(tt.raw)
+			if err != nil {
+				t.Fatalf("NormalizeURL(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	for _, raw := range []string{"", "   ", "ftp://photos.example.com", "https://", "https:///api"} {
+		if got, err := NormalizeURL(raw); err == nil {
+			t.Errorf("NormalizeURL(%q) = %q, want an error", raw, got)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	srv := immichtest.NewServer(t)
+
+	// A proxy that serves the well-known document itself, or redirects it
+	proxy := func(handler http.HandlerFunc) string {
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+		return s.URL
+	}
+	relative := proxy(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"api":{"endpoint":"/immich/api/"}}`))
+	})
+	redirected := proxy(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+"/.well-known/immich", http.StatusFound)
+	})
+	missing := proxy(http.NotFound)
+	invalid := proxy(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"immich", srv.URL, srv.URL},
+		{"api suffix", srv.URL + "/api/", srv.URL},
+		{"relative endpoint", relative + "/", relative + "/immich"},
+		{"redirected", redirected, srv.URL},
+		{"no well-known", missing + "/photos", missing + "/photos"},
+		{"invalid well-known", invalid, invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Discover(context.Background(), tt.raw)
+			if err != nil {
+				t.Fatalf("Discover(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Discover(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	// The discovered URL is one the API answers under
+	url, err := Discover(context.Background(), redirected)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if _, err := Run(context.Background(), url, srv.APIKey, nil); err != nil {
+		t.Errorf("Run against the discovered URL: %v", err)
+	}
+}
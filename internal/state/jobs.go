@@ -0,0 +1,304 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Every job is kept in its own directory, jobs/<id> in the app data
+// directory, with its state file and asset store. Finished jobs stay there,
+// so what they uploaded can be looked up and rolled back.
+
+// ErrJobNotFound is returned by LoadJob when there is no job with the ID
+var ErrJobNotFound = errors.New("import job not found")
+
+// BrokenJobError is returned for a job whose state file cannot be loaded, e.g.
+// because it is corrupt or from a newer version. RemoveJob still removes it.
+type BrokenJobError struct {
+	ID  string
+	Err error
+}
+
+func (e *BrokenJobError) Error() string {
+	return fmt.Sprintf("failed to load job %s: %v", e.ID, e.Err)
+}
+
+func (e *BrokenJobError) Unwrap() error {
+	return e.Err
+}
+
+// Load loads the current job: the one saved most recently. It returns nil if
+// there are no jobs, and a *BrokenJobError if the current job is broken.
+func Load() (*JobState, error) {
+	jobs, err := ListJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	var current *JobState
+	for _, job := range jobs {
+		if current == nil || job.UpdatedAt.After(current.UpdatedAt) {
+			current = job
+		}
+	}
+	if current != nil && current.LoadErr != nil {
+		return nil, current.LoadErr
+	}
+	return current, nil
+}
+
+// LoadJob loads the job with the given ID, or the only job whose ID starts
+// with it
+func LoadJob(id string) (*JobState, error) {
+	if err := migrateLayout(); err != nil {
+		return nil, err
+	}
+	if validJobID(id) {
+		dir, err := jobsDir()
+		if err != nil {
+			return nil, err
+		}
+		job, err := loadJob(filepath.Join(dir, id, "state.json"))
+		if err == nil {
+			return job, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, &BrokenJobError{ID: id, Err: err}
+		}
+	}
+
+	jobs, err := ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	var found *JobState
+	for _, job := range jobs {
+		if id == "" || !strings.HasPrefix(job.ID, id) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("job ID %s is ambiguous, it matches %s and %s", id, found.ID, job.ID)
+		}
+		found = job
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if found.LoadErr != nil {
+		return nil, found.LoadErr
+	}
+	return found, nil
+}
+
+// ListJobs loads every job, oldest first. A job that cannot be loaded does not
+// fail the list; it is returned with status "broken" and its LoadErr set.
+func ListJobs() ([]*JobState, error) {
+	if err := migrateLayout(); err != nil {
+		return nil, err
+	}
+
+	dir, err := jobsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*JobState
+	for _, e := range entries {
+		if !e.IsDir() || !validJobID(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name(), "state.json")
+		job, err := loadJob(path)
+		if os.IsNotExist(err) {
+			continue // a job that was never saved
+		}
+		if err != nil {
+			job = brokenJob(e.Name(), path, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// loadJob loads the state file at path, migrating it from an older schema
+// version
+func loadJob(path string) (*JobState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state JobState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if filepath.Base(filepath.Dir(path)) != state.ID {
+		return nil, fmt.Errorf("%s is the state of job %s", path, state.ID)
+	}
+	if err := state.migrate(data); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// brokenJob stands in for a job whose state file at path cannot be loaded. It
+// is dated by the file, so a broken current job stays the current one.
+func brokenJob(id, path string, err error) *JobState {
+	job := &JobState{
+		ID:      id,
+		Status:  "broken",
+		LoadErr: &BrokenJobError{ID: id, Err: err},
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		job.CreatedAt = info.ModTime()
+		job.UpdatedAt = info.ModTime()
+	}
+	return job
+}
+
+// Remove deletes the job: its state file and its asset store
+func (s *JobState) Remove() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := s.Unlock(); err != nil {
+		return err
+	}
+	return RemoveJob(s.ID)
+}
+
+// RemoveJob deletes the job with the given ID without loading it, so a
+// broken job can be removed too. A running job is not removed.
+func RemoveJob(id string) error {
+	job := &JobState{ID: id}
+	dir, err := job.dir()
+	if err != nil {
+		return err
+	}
+	if err := job.Lock(); err != nil {
+		return err
+	}
+	// The lock file goes with the directory; Windows cannot delete it open
+	job.Unlock()
+	return os.RemoveAll(dir)
+}
+
+// migrateLayout moves the state file of the single job kept before the jobs
+// directory into it, with its asset store and backups
+func migrateLayout() error {
+	base, err := appDataDir()
+	if err != nil {
+		return err
+	}
+	legacy := filepath.Join(base, "state.json")
+	data, err := os.ReadFile(legacy)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var job JobState
+	if err := json.Unmarshal(data, &job); err != nil {
+		return fmt.Errorf("failed to read %s: %w", legacy, err)
+	}
+	dir, err := job.dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// The state file goes last: while it is left, the move is not finished
+	names, _ := filepath.Glob(filepath.Join(base, "*.bak"))
+	names = append(names, filepath.Join(base, "assets.log"), legacy)
+	for _, name := range names {
+		err := os.Rename(name, filepath.Join(dir, filepath.Base(name)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to move job %s into the jobs directory: %w", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// dir returns the directory the job is kept in
+func (s *JobState) dir() (string, error) {
+	if !validJobID(s.ID) {
+		return "", fmt.Errorf("invalid job ID %q", s.ID)
+	}
+	dir, err := jobsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.ID), nil
+}
+
+func (s *JobState) statePath() (string, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+func (s *JobState) storePath() (string, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "assets.log"), nil
+}
+
+// ReportPath returns the path of a report file in the job's directory, so the
+// report is removed together with the job
+func (s *JobState) ReportPath(name string) (string, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func jobsDir() (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobs"), nil
+}
+
+// validJobID reports whether id can name a job directory. IDs are generated
+// as hex, so this only guards against a tampered state file.
+func validJobID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/davidaniva/immich-importer/internal/fsutil"
+)
+
+// journal is an append-only file of JSON records, one per line. An append is
+// on disk once it returns.
+type journal struct {
+	path string
+	file *os.File
+}
+
+// openJournal opens the journal at path, creating it if needed, and calls read
+// with each record in order. A torn last record, from a crash during an
+// append, is cut off.
+func openJournal(path string, read func(data []byte) error) (*journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	var good int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // EOF, or a last line without newline: torn
+		}
+		if read != nil && read(bytes.TrimSpace(line)) != nil {
+			break
+		}
+		good += int64(len(line))
+	}
+
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to repair journal: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &journal{path: path, file: f}, nil
+}
+
+// append writes a record and syncs it to disk
+func (j *journal) append(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// truncate empties the journal
+func (j *journal) truncate() error {
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to empty journal: %w", err)
+	}
+	_, err := j.file.Seek(0, io.SeekStart)
+	return err
+}
+
+// replace swaps the journal's content for data, written atomically
+func (j *journal) replace(data []byte) error {
+	// The file is replaced, so it cannot stay open on Windows
+	j.file.Close()
+	writeErr := fsutil.WriteFileAtomic(j.path, data, 0600)
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = f
+	if writeErr != nil {
+		return fmt.Errorf("failed to rewrite journal: %w", writeErr)
+	}
+	return nil
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrJobLocked is returned by Lock when another process is running the job
+var ErrJobLocked = errors.New("import job is running in another process")
+
+// Lock takes the job's lock file, jobs/<id>/lock, so no other process runs,
+// resumes or cleans up the job at the same time. The lock is held by the
+// operating system, so it is released when the process exits, even after a
+// crash.
+func (s *JobState) Lock() error {
+	if s.lock != nil {
+		return nil
+	}
+	f, err := s.openLock()
+	if err != nil {
+		return err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return fmt.Errorf("%w: %s", ErrJobLocked, s.ID)
+		}
+		return fmt.Errorf("failed to lock job: %w", err)
+	}
+	s.lock = f
+	return nil
+}
+
+// Unlock releases the lock taken by Lock
+func (s *JobState) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+	err := s.lock.Close()
+	s.lock = nil
+	return err
+}
+
+// Locked reports whether a process holds the job's lock, i.e. the job is
+// running. A job locked by this JobState does not count.
+func (s *JobState) Locked() bool {
+	if s.lock != nil {
+		return false
+	}
+	f, err := s.openLock()
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return errors.Is(lockFile(f), errLocked)
+}
+
+func (s *JobState) openLock() (*os.File, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, "lock"), os.O_RDWR|os.O_CREATE, 0600)
+}
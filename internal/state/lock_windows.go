@@ -0,0 +1,15 @@
+package state
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errLocked = windows.ERROR_LOCK_VIOLATION
+
+// lockFile takes an exclusive lock on f without waiting. Closing f releases it.
+func lockFile(f *os.File) error {
+	var overlapped windows.Overlapped
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/davidaniva/immich-importer/internal/fsutil"
+)
+
+// SchemaVersion is the version of the state format this build writes. State
+// files without a version are version 0.
+const SchemaVersion = 3
+
+// migrations upgrade the job state from the schema version of their index to
+// the next. They run on the loaded state with its asset store open. Builds
+// from before schema versions wrote several formats as version 0, so a
+// migration must leave a state that is already in the newer format alone.
+var migrations = []func(s *JobState) error{
+	0: (*JobState).migrateAssetStatus, // upload status instead of a duplicate flag
+	1: (*JobState).migrateUploads,     // per-asset tracking in the asset store
+	2: (*JobState).migrateEntryIDs,    // entry IDs by Drive file ID
+}
+
+// migrate upgrades a state loaded from an older schema version to
+// SchemaVersion, saving after each step. The state file and the asset store
+// are backed up first.
+func (s *JobState) migrate(data []byte) error {
+	if s.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("state was saved by a newer version of immich-importer (schema version %d, this version supports up to %d)", s.SchemaVersion, SchemaVersion)
+	}
+	if s.SchemaVersion == SchemaVersion {
+		return nil
+	}
+
+	if err := s.backup(data); err != nil {
+		return fmt.Errorf("failed to back up state before migrating: %w", err)
+	}
+
+	if s.UploadState != nil {
+		if _, err := s.OpenUploadState(); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	for s.SchemaVersion < SchemaVersion {
+		if err := migrations[s.SchemaVersion](s); err != nil {
+			return fmt.Errorf("failed to migrate state from schema version %d: %w", s.SchemaVersion, err)
+		}
+		s.SchemaVersion++
+		if err := s.Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backup copies the state file, whose content is data, and the asset store
+// next to them as <name>.v<version>.bak. An existing backup is kept: it is
+// from before an earlier, interrupted attempt.
+func (s *JobState) backup(data []byte) error {
+	path, err := s.statePath()
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteBackup(path, data, s.SchemaVersion); err != nil {
+		return err
+	}
+
+	store, err := s.storePath()
+	if err != nil {
+		return err
+	}
+	data, err = os.ReadFile(store)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteBackup(store, data, s.SchemaVersion)
+}
+
+// migrateAssetStatus gives asset records from before upload statuses, which
+// only flagged duplicates, a status, and counts them
+func (s *JobState) migrateAssetStatus() error {
+	u := s.UploadState
+	if u == nil {
+		return nil
+	}
+
+	count := u.CreatedAssets == 0 && u.DuplicateAssets == 0
+	for e, record := range u.Assets {
+		if record.Status == "" {
+			record.Status = AssetCreated
+			if record.Duplicate {
+				record.Status = AssetDuplicate
+			}
+		}
+		record.Duplicate = false
+		u.Assets[e] = record
+
+		if count {
+			switch record.Status {
+			case AssetCreated:
+				u.CreatedAssets++
+			case AssetDuplicate:
+				u.DuplicateAssets++
+			}
+		}
+	}
+	return nil
+}
@@ -4,22 +4,45 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
+
+	"github.com/davidaniva/immich-importer/internal/fsutil"
 )
 
 // JobState tracks the overall import job progress
 type JobState struct {
+	// SchemaVersion is the format the state was saved in, see migrations
+	SchemaVersion int `json:"schemaVersion"`
+
 	ID          string       `json:"id"`
 	ServerURL   string       `json:"serverUrl"`
-	Status      string       `json:"status"` // idle, downloading, uploading, complete, error, cancelled
+	Status      string       `json:"status"` // idle, downloading, uploading, complete, error, cancelled, rolled-back
 	Files       []FileState  `json:"files"`
 	UploadState *UploadState `json:"uploadState,omitempty"`
 	LastError   string       `json:"lastError,omitempty"`
-	CreatedAt   time.Time    `json:"createdAt"`
-	UpdatedAt   time.Time    `json:"updatedAt"`
+
+	// JournalSeq is the last asset store record the saved state includes
+	JournalSeq int64 `json:"journalSeq,omitempty"`
+
+	// Set on the first upload and kept for the rest of the job, so every
+	// asset of a job can be found in Immich
+	DeviceID string `json:"deviceId,omitempty"` // deviceId of the uploads
+	Tag      string `json:"tag,omitempty"`      // tag added to every asset
+	Album    string `json:"album,omitempty"`    // album every asset is added to
+	UserID   string `json:"userId,omitempty"`   // Immich user the assets belong to
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// LoadErr is why a job listed by ListJobs could not be loaded. Such a
+	// job has only its ID and status "broken", and can only be removed.
+	LoadErr error `json:"-"`
+
+	lock *os.File // held while the job runs, see Lock
 }
 
 // FileState tracks individual file download/upload progress
@@ -32,21 +55,76 @@ type FileState struct {
 	BytesDownloaded int64  `json:"bytesDownloaded"`
 }
 
-// UploadState tracks upload progress
+// UploadState tracks upload progress. What happened to each archive entry is
+// kept in an AssetStore next to the state file, see OpenUploadState.
 type UploadState struct {
-	TotalPhotos    int      `json:"totalPhotos"`
-	UploadedPhotos int      `json:"uploadedPhotos"`
-	UploadedFiles  []string `json:"uploadedFiles"`
+	TotalPhotos    int `json:"totalPhotos"`
+	UploadedPhotos int `json:"uploadedPhotos"`
+
+	// Entries that became new assets, and entries whose content Immich or
+	// this job had already
+	CreatedAssets   int `json:"createdAssets"`
+	DuplicateAssets int `json:"duplicateAssets"`
+
+	// Entries that replaced the file of an existing Immich asset
+	ReplacedAssets int `json:"replacedAssets,omitempty"`
+
+	// AlbumIDs maps album names to the Immich albums assets were added to
+	AlbumIDs map[string]string `json:"albumIds,omitempty"`
+
+	// TagIDs maps tag values such as "People/Alice" to Immich tag IDs
+	TagIDs map[string]string `json:"tagIds,omitempty"`
+
+	// CreatedAlbums lists the IDs of the albums this job created
+	CreatedAlbums []string `json:"createdAlbums,omitempty"`
+
+	// Assets still to be added to albums and tagged, by album name and tag
+	PendingAlbums map[string][]string `json:"pendingAlbums,omitempty"`
+	PendingTags   map[string][]string `json:"pendingTags,omitempty"`
+
+	// Assets still to be moved to the Immich trash
+	PendingTrash []string `json:"pendingTrash,omitempty"`
+
+	// Per-asset tracking in state files from before the asset store. It is
+	// moved into the store when the upload state is opened.
+	UploadedFiles []string               `json:"uploadedFiles,omitempty"`
+	Assets        map[string]AssetRecord `json:"assets,omitempty"`
+	AssetHashes   map[string]string      `json:"assetHashes,omitempty"`
+	StackIDs      []string               `json:"stackIds,omitempty"`
+
+	store AssetStore
+
+	// Changes since the last record, see MarkUploaded
+	pending *Record
 }
 
+// AssetRecord is the Immich asset an archive entry was uploaded as
+type AssetRecord struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+
+	// Duplicate is how records from before Status marked duplicates. It is
+	// replaced by Status when the state is loaded.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// Upload statuses. An entry is a duplicate if the server had its content
+// already, or another entry of the job had the same content.
+const (
+	AssetCreated   = "created"
+	AssetDuplicate = "duplicate"
+	AssetReplaced  = "replaced"
+)
+
 // New creates a new JobState
 func New() *JobState {
 	return &JobState{
-		ID:        generateID(),
-		Status:    "idle",
-		Files:     []FileState{},
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		SchemaVersion: SchemaVersion,
+		ID:            generateID(),
+		Status:        "idle",
+		Files:         []FileState{},
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 }
 
@@ -56,32 +134,13 @@ func generateID() string {
 	return hex.EncodeToString(b)
 }
 
-// Load loads state from disk
-func Load() (*JobState, error) {
-	path, err := statePath()
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-
-	var state JobState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, err
-	}
-
-	return &state, nil
-}
-
-// Save saves state to disk
+// Save saves state to disk, replacing the previous state only once the new
+// one is written completely
 func (s *JobState) Save() error {
-	path, err := statePath()
+	if s.LoadErr != nil {
+		return s.LoadErr
+	}
+	path, err := s.statePath()
 	if err != nil {
 		return err
 	}
@@ -98,16 +157,15 @@ func (s *JobState) Save() error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0600)
-}
+	if err := fsutil.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
 
-// Clear removes the state file
-func Clear() error {
-	path, err := statePath()
-	if err != nil {
-		return err
+	// The saved state includes every record, so the store may drop old ones
+	if s.UploadState != nil && s.UploadState.store != nil {
+		return s.UploadState.store.Compact(s.JournalSeq)
 	}
-	return os.Remove(path)
+	return nil
 }
 
 // AddFile adds a file to track
@@ -128,6 +186,12 @@ func (s *JobState) AddFile(driveID, name string, size int64) {
 	})
 }
 
+// Finished reports whether the job is done: complete, or rolled back. A
+// finished job is kept for rollback but not resumed.
+func (s *JobState) Finished() bool {
+	return s.Status == "complete" || s.Status == "rolled-back"
+}
+
 // GetDownloadProgress returns download progress (0-100)
 func (s *JobState) GetDownloadProgress() float64 {
 	if len(s.Files) == 0 {
@@ -159,14 +223,6 @@ func (s *JobState) GetUploadProgress() float64 {
 	return float64(s.UploadState.UploadedPhotos) / float64(s.UploadState.TotalPhotos) * 100
 }
 
-func statePath() (string, error) {
-	dir, err := appDataDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, "state.json"), nil
-}
-
 func appDataDir() (string, error) {
 	var baseDir string
 
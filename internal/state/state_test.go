@@ -0,0 +1,663 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// useTempDir points the app data directory at a temporary directory
+func useTempDir(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("APPDATA", home)
+	dir, err := appDataDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// jobDir returns the directory a job is kept in
+func jobDir(t *testing.T, s *JobState) string {
+	t.Helper()
+	dir, err := s.dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// newJob returns a saved job with its upload state open
+func newJob(t *testing.T) *JobState {
+	t.Helper()
+	s := New()
+	if _, err := s.OpenUploadState(); err != nil {
+		t.Fatalf("OpenUploadState: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return s
+}
+
+// load loads the saved job with its upload state open
+func load(t *testing.T) *JobState {
+	t.Helper()
+	s, err := Load()
+	if err != nil || s == nil {
+		t.Fatalf("Load: %v, %v", s, err)
+	}
+	if _, err := s.OpenUploadState(); err != nil {
+		t.Fatalf("OpenUploadState: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// upload records an entry as uploaded the way the importer does
+func upload(t *testing.T, s *JobState, entryID, assetID string) {
+	t.Helper()
+	s.UploadState.RecordHash("hash-"+assetID, assetID)
+	s.UploadState.RecordAsset(entryID, AssetRecord{ID: assetID, Status: AssetCreated})
+	s.UploadState.QueueAlbumAdd("Trip", assetID)
+	if err := s.MarkUploaded([]string{entryID}, 1); err != nil {
+		t.Fatalf("MarkUploaded: %v", err)
+	}
+}
+
+func TestRecordsReplayedAfterCrash(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	upload(t, s, "a.zip:IMG_1.jpg", "asset-1")
+	s.UploadState.PendingAlbums = nil // filed into the album before saving
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Uploads after the last save are only in the asset store
+	upload(t, s, "a.zip:IMG_2.jpg", "asset-2")
+	upload(t, s, "a.zip:IMG_3.jpg", "asset-3")
+	s.Close()
+
+	loaded := load(t)
+	u := loaded.UploadState
+	for _, e := range []string{"a.zip:IMG_1.jpg", "a.zip:IMG_2.jpg", "a.zip:IMG_3.jpg"} {
+		if !u.Uploaded(e) {
+			t.Errorf("%s not uploaded", e)
+		}
+	}
+	if u.UploadedPhotos != 3 || u.CreatedAssets != 3 {
+		t.Errorf("counters after replay: %d photos, %d created; want 3 and 3", u.UploadedPhotos, u.CreatedAssets)
+	}
+	if id, _ := u.AssetByHash("hash-asset-3"); id != "asset-3" {
+		t.Errorf("AssetByHash = %q, want asset-3", id)
+	}
+	if want := []string{"asset-2", "asset-3"}; !reflect.DeepEqual(u.PendingAlbums["Trip"], want) {
+		t.Errorf("PendingAlbums = %v, want %v", u.PendingAlbums, want)
+	}
+	if want := []string{"asset-1", "asset-2", "asset-3"}; !reflect.DeepEqual(u.CreatedAssetIDs(), want) {
+		t.Errorf("CreatedAssetIDs = %v, want %v", u.CreatedAssetIDs(), want)
+	}
+
+	// Once saved, the records are not replayed again
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded.Close()
+	again := load(t)
+	if again.UploadState.UploadedPhotos != 3 || again.UploadState.CreatedAssets != 3 {
+		t.Errorf("counters after save and load: %+v", again.UploadState)
+	}
+}
+
+func TestDuplicateCountedOnce(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	upload(t, s, "a.zip:IMG_1.jpg", "asset-1")
+	s.UploadState.RecordAsset("a.zip:IMG_1.jpg", AssetRecord{ID: "asset-1", Status: AssetDuplicate})
+	s.UploadState.RecordAsset("b.zip:IMG_1.jpg", AssetRecord{ID: "asset-1", Status: AssetDuplicate})
+	if err := s.MarkUploaded([]string{"b.zip:IMG_1.jpg"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if u := s.UploadState; u.CreatedAssets != 1 || u.DuplicateAssets != 1 {
+		t.Errorf("got %d created and %d duplicate, want 1 and 1", u.CreatedAssets, u.DuplicateAssets)
+	}
+}
+
+func TestReplacedCounted(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	upload(t, s, "a.zip:IMG_1.jpg", "asset-1")
+	s.UploadState.RecordAsset("a.zip:IMG_2.jpg", AssetRecord{ID: "asset-2", Status: AssetReplaced})
+	if err := s.MarkUploaded([]string{"a.zip:IMG_2.jpg"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if u := s.UploadState; u.CreatedAssets != 1 || u.DuplicateAssets != 0 || u.ReplacedAssets != 1 {
+		t.Errorf("got %d created, %d duplicate and %d replaced, want 1, 0 and 1", u.CreatedAssets, u.DuplicateAssets, u.ReplacedAssets)
+	}
+
+	// Replayed from the store after a crash before the next save
+	s.Close()
+	if got := load(t).UploadState.ReplacedAssets; got != 1 {
+		t.Errorf("replayed ReplacedAssets = %d, want 1", got)
+	}
+}
+
+func TestTornRecordIsCutOff(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	upload(t, s, "a.zip:IMG_1.jpg", "asset-1")
+	s.Close()
+
+	path := filepath.Join(jobDir(t, s), "assets.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":2,"entries":["a.zip:IMG_2.j`)
+	f.Close()
+
+	loaded := load(t)
+	if loaded.UploadState.Uploaded("a.zip:IMG_2.jpg") || !loaded.UploadState.Uploaded("a.zip:IMG_1.jpg") {
+		t.Error("torn record applied, or good record lost")
+	}
+
+	// Records appended after the repair are read back
+	upload(t, loaded, "a.zip:IMG_3.jpg", "asset-3")
+	loaded.Close()
+	if !load(t).UploadState.Uploaded("a.zip:IMG_3.jpg") {
+		t.Error("record appended after a torn one was lost")
+	}
+}
+
+func TestOldStateMigratedIntoStore(t *testing.T) {
+	dir := useTempDir(t)
+
+	old := `{
+  "id": "0123456789abcdef",
+  "status": "uploading",
+  "files": [],
+  "uploadState": {
+    "totalPhotos": 10,
+    "uploadedPhotos": 2,
+    "uploadedFiles": ["/downloads/a.zip:IMG_1.jpg", "/downloads/a.zip:IMG_2.jpg"],
+    "createdAssets": 2,
+    "assetHashes": {"hash-1": "asset-1", "hash-2": "asset-2"},
+    "assets": {
+      "/downloads/a.zip:IMG_1.jpg": {"id": "asset-1", "status": "created"},
+      "/downloads/a.zip:IMG_2.jpg": {"id": "asset-2", "status": "created"}
+    }
+  }
+}`
+	os.MkdirAll(dir, 0700)
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := load(t)
+	u := s.UploadState
+	if !u.Uploaded("/downloads/a.zip:IMG_2.jpg") || len(u.CreatedAssetIDs()) != 2 {
+		t.Errorf("per-asset tracking not moved into the store")
+	}
+	if u.UploadedFiles != nil || u.Assets != nil || u.AssetHashes != nil {
+		t.Errorf("per-asset tracking still in the job state: %+v", u)
+	}
+	if u.UploadedPhotos != 2 || u.CreatedAssets != 2 {
+		t.Errorf("counters changed by the migration: %+v", u)
+	}
+
+	data, err := os.ReadFile(filepath.Join(jobDir(t, s), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 600 {
+		t.Errorf("saved state still has per-asset tracking:\n%s", data)
+	}
+}
+
+func TestForgetAndReset(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	upload(t, s, "a.zip:IMG_1.jpg", "asset-1")
+	upload(t, s, "a.zip:IMG_2.jpg", "asset-2")
+	if err := s.ForgetAssets([]string{"asset-1"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	loaded := load(t)
+	if got := loaded.UploadState.CreatedAssetIDs(); !reflect.DeepEqual(got, []string{"asset-2"}) {
+		t.Errorf("CreatedAssetIDs after forgetting = %v", got)
+	}
+	if _, ok := loaded.UploadState.AssetByHash("hash-asset-1"); ok {
+		t.Error("hash of a forgotten asset still known")
+	}
+
+	if err := loaded.ResetUploads(); err != nil {
+		t.Fatalf("ResetUploads: %v", err)
+	}
+	if loaded.UploadState != nil {
+		t.Error("upload state kept")
+	}
+	if _, err := os.Stat(filepath.Join(jobDir(t, s), "assets.log")); !os.IsNotExist(err) {
+		t.Errorf("asset store not removed: %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	path := filepath.Join(jobDir(t, s), "assets.log")
+	for n := 0; n < 2500; n++ {
+		upload(t, s, fmt.Sprintf("a.zip:IMG_%04d.jpg", n), fmt.Sprintf("asset-%04d", n))
+	}
+	s.UploadState.AddStack("asset-0001", "stack-1")
+	if err := s.MarkUploaded(nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	before := s.UploadState.CreatedAssetIDs()
+
+	// Pretend enough records were appended to be worth compacting
+	store := s.UploadState.store.(*logStore)
+	store.appended = compactAfter
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if store.appended >= 2500 {
+		t.Errorf("%d records after compacting", store.appended)
+	}
+
+	// Appending still works, and nothing was lost
+	upload(t, s, "b.zip:IMG_1.jpg", "asset-b")
+	s.Close()
+	data, _ := os.ReadFile(path)
+	if len(data) == 0 {
+		t.Fatal("store empty after compacting")
+	}
+
+	loaded := load(t)
+	after := loaded.UploadState.CreatedAssetIDs()
+	if len(after) != len(before)+1 {
+		t.Errorf("got %d created assets after compacting, want %d", len(after), len(before)+1)
+	}
+	want := append([]string{"asset-b"}, before...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(after, want) {
+		t.Error("created assets changed by compacting")
+	}
+	if loaded.UploadState.UploadedPhotos != 2501 {
+		t.Errorf("UploadedPhotos = %d, want 2501", loaded.UploadState.UploadedPhotos)
+	}
+	if !loaded.UploadState.Stacked("asset-0001") || loaded.UploadState.Stacked("asset-0002") {
+		t.Error("stack lost by compacting")
+	}
+}
+
+func TestSaveLeavesNoTemporaryFiles(t *testing.T) {
+	useTempDir(t)
+
+	s := New()
+	dir := jobDir(t, s)
+	for n := 0; n < 3; n++ {
+		if err := s.Save(); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("files after saving: %v", entries)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "state.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("state.json: %v, %v", info, err)
+	}
+}
+
+func TestEntryIDsMigratedToDriveIDs(t *testing.T) {
+	dir := useTempDir(t)
+
+	// Entries of part 2 were recorded under a download directory that has
+	// since moved
+	old := `{
+  "id": "0123456789abcdef",
+  "status": "uploading",
+  "files": [
+    {"driveId": "drive-1", "name": "takeout-001.zip", "downloaded": true, "localPath": "/data/downloads/takeout-001.zip"},
+    {"driveId": "drive-2", "name": "takeout-002.zip", "downloaded": true, "localPath": "/data/downloads/takeout-002.zip"}
+  ],
+  "uploadState": {
+    "uploadedPhotos": 3,
+    "uploadedFiles": [
+      "/data/downloads/takeout-001.zip:Takeout/Google Photos/Trip/IMG_1.jpg",
+      "/old/downloads/takeout-002.zip:Takeout/Google Photos/Trip/IMG_2.jpg",
+      "C:\\Users\\me\\downloads\\takeout-002.zip:Takeout/Google Photos/Trip/IMG_3.jpg"
+    ],
+    "assets": {
+      "/data/downloads/takeout-001.zip:Takeout/Google Photos/Trip/IMG_1.jpg": {"id": "asset-1", "status": "created"}
+    }
+  }
+}`
+	os.MkdirAll(dir, 0700)
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := load(t)
+	u := s.UploadState
+	for _, id := range []string{
+		EntryID("drive-1", "Takeout/Google Photos/Trip/IMG_1.jpg"),
+		EntryID("drive-2", "Takeout/Google Photos/Trip/IMG_2.jpg"),
+		EntryID("drive-2", "Takeout/Google Photos/Trip/IMG_3.jpg"),
+	} {
+		if !u.Uploaded(id) {
+			t.Errorf("%s not uploaded after migration", id)
+		}
+	}
+	if record, ok := u.Asset(EntryID("drive-1", "Takeout/Google Photos/Trip/IMG_1.jpg")); !ok || record.ID != "asset-1" {
+		t.Errorf("asset record not migrated: %+v", record)
+	}
+	if u.Uploaded("/data/downloads/takeout-001.zip:Takeout/Google Photos/Trip/IMG_1.jpg") {
+		t.Error("old entry ID still recorded")
+	}
+
+	// The migrated store is what is read back
+	data, err := os.ReadFile(filepath.Join(jobDir(t, s), "assets.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "downloads") {
+		t.Errorf("asset store still has old entry IDs:\n%s", data)
+	}
+}
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	if len(migrations) != SchemaVersion {
+		t.Errorf("%d migrations for schema version %d", len(migrations), SchemaVersion)
+	}
+}
+
+// Each fixture is the same job, half uploaded, saved in a format an earlier
+// version wrote
+func TestLoadPreviousVersions(t *testing.T) {
+	tests := []struct {
+		fixture string
+		version int
+		assets  bool // has asset records
+	}{
+		{"v0-baseline", 0, false},
+		{"v0-duplicate-flag", 0, true},
+		{"v0-upload-status", 0, true},
+		{"v0-asset-store", 0, true},
+		{"v0-drive-ids", 0, true},
+		{"v1", 1, true},
+		{"v2", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			dir := useTempDir(t)
+			os.MkdirAll(dir, 0700)
+			originals := make(map[string][]byte)
+			for _, name := range []string{"state.json", "assets.log"} {
+				data, err := os.ReadFile(filepath.Join("testdata", tt.fixture, name))
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				originals[name] = data
+				if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := load(t)
+			if s.SchemaVersion != SchemaVersion {
+				t.Errorf("SchemaVersion = %d, want %d", s.SchemaVersion, SchemaVersion)
+			}
+			u := s.UploadState
+			for _, name := range []string{"IMG_1.jpg", "IMG_2.jpg"} {
+				if id := EntryID("drive-1", "Takeout/Google Photos/Trip/"+name); !u.Uploaded(id) {
+					t.Errorf("%s not uploaded", id)
+				}
+			}
+			if u.TotalPhotos != 10 || u.UploadedPhotos != 2 {
+				t.Errorf("uploaded %d of %d photos, want 2 of 10", u.UploadedPhotos, u.TotalPhotos)
+			}
+			if tt.assets {
+				if got := u.CreatedAssetIDs(); !reflect.DeepEqual(got, []string{"asset-1"}) {
+					t.Errorf("CreatedAssetIDs = %v, want [asset-1]", got)
+				}
+				if u.CreatedAssets != 1 || u.DuplicateAssets != 1 {
+					t.Errorf("got %d new and %d duplicate assets, want 1 and 1", u.CreatedAssets, u.DuplicateAssets)
+				}
+				if id, ok := u.AssetByHash("hash-1"); !ok || id != "asset-1" {
+					t.Errorf("AssetByHash = %q, %v", id, ok)
+				}
+				if s.UploadState.AlbumIDs["Trip"] != "album-1" || s.Tag == "" {
+					t.Errorf("job state not kept: %+v", s)
+				}
+			}
+
+			for name, data := range originals {
+				backup, err := os.ReadFile(filepath.Join(jobDir(t, s), fmt.Sprintf("%s.v%d.bak", name, tt.version)))
+				if err != nil || string(backup) != string(data) {
+					t.Errorf("%s not backed up: %v", name, err)
+				}
+			}
+
+			// The migrated state loads as it is
+			created := u.CreatedAssetIDs()
+			s.Close()
+			again := load(t)
+			if again.UploadState.UploadedPhotos != 2 || !reflect.DeepEqual(again.UploadState.CreatedAssetIDs(), created) {
+				t.Errorf("migrated state changed when loaded again: %+v", again.UploadState)
+			}
+			entries, _ := os.ReadDir(jobDir(t, s))
+			if len(entries) != 2+len(originals) {
+				t.Errorf("files after loading twice: %v", entries)
+			}
+		})
+	}
+}
+
+func TestNewerVersionIsNotLoaded(t *testing.T) {
+	dir := useTempDir(t)
+
+	os.MkdirAll(dir, 0700)
+	newer := fmt.Sprintf(`{"schemaVersion": %d, "id": "0123456789abcdef", "status": "uploading"}`, SchemaVersion+1)
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(newer), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("Load of a newer state returned %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "jobs", "0123456789abcdef", "state.json"))
+	if string(data) != newer {
+		t.Error("newer state was changed")
+	}
+}
+
+func TestJobsKeptSeparately(t *testing.T) {
+	useTempDir(t)
+
+	first := newJob(t)
+	upload(t, first, "a.zip:IMG_1.jpg", "asset-1")
+	first.Status = "complete"
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	second := newJob(t)
+	upload(t, second, "b.zip:IMG_1.jpg", "asset-2")
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+
+	jobs, err := ListJobs()
+	if err != nil || len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Fatalf("ListJobs = %v, %v", jobs, err)
+	}
+	if current := load(t); current.ID != second.ID {
+		t.Errorf("current job is %s, want the last saved %s", current.ID, second.ID)
+	}
+
+	// The finished job keeps what it uploaded
+	job, err := LoadJob(first.ID[:8])
+	if err != nil || job.ID != first.ID {
+		t.Fatalf("LoadJob by prefix = %v, %v", job, err)
+	}
+	if !job.Finished() {
+		t.Error("complete job not finished")
+	}
+	u, err := job.OpenUploadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer job.Close()
+	if got := u.CreatedAssetIDs(); !reflect.DeepEqual(got, []string{"asset-1"}) {
+		t.Errorf("CreatedAssetIDs of the first job = %v", got)
+	}
+
+	if _, err := LoadJob("ffff"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("LoadJob of an unknown job returned %v", err)
+	}
+
+	if err := job.Remove(); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if jobs, _ := ListJobs(); len(jobs) != 1 || jobs[0].ID != second.ID {
+		t.Errorf("jobs after removing one: %v", jobs)
+	}
+}
+
+func TestSingleStateMovedIntoJobs(t *testing.T) {
+	dir := useTempDir(t)
+
+	os.MkdirAll(dir, 0700)
+	for _, name := range []string{"state.json", "assets.log"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "v2", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := load(t)
+	if s.ID != "0123456789abcdef0123456789abcdef" || !s.UploadState.Uploaded(EntryID("drive-1", "Takeout/Google Photos/Trip/IMG_2.jpg")) {
+		t.Errorf("job not moved with its uploads: %+v", s)
+	}
+	for _, name := range []string{"state.json", "assets.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left outside the jobs directory: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "jobs", s.ID, name)); err != nil {
+			t.Errorf("%s not in the job directory: %v", name, err)
+		}
+	}
+}
+
+func TestBrokenJobListed(t *testing.T) {
+	useTempDir(t)
+
+	good := newJob(t)
+	good.Close()
+	broken := newJob(t)
+	broken.Close()
+	path := filepath.Join(jobDir(t, broken), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := ListJobs()
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("ListJobs = %v, %v", jobs, err)
+	}
+	var brokenErr *BrokenJobError
+	if got := jobs[1]; got.ID != broken.ID || got.Status != "broken" || !errors.As(got.LoadErr, &brokenErr) {
+		t.Errorf("broken job listed as %+v", got)
+	}
+	if err := jobs[1].Save(); err == nil {
+		t.Error("Save of a broken job succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{not json" {
+		t.Error("broken state was changed")
+	}
+
+	// The broken job is the current one, so it is not silently skipped
+	if _, err := Load(); !errors.As(err, &brokenErr) || brokenErr.ID != broken.ID {
+		t.Errorf("Load with a broken current job returned %v", err)
+	}
+	if _, err := LoadJob(broken.ID[:8]); !errors.As(err, &brokenErr) {
+		t.Errorf("LoadJob of a broken job by prefix returned %v", err)
+	}
+	if _, err := LoadJob(broken.ID); !errors.As(err, &brokenErr) {
+		t.Errorf("LoadJob of a broken job returned %v", err)
+	}
+
+	if err := RemoveJob(broken.ID); err != nil {
+		t.Fatalf("RemoveJob: %v", err)
+	}
+	if current := load(t); current.ID != good.ID {
+		t.Errorf("current job after removing the broken one is %s, want %s", current.ID, good.ID)
+	}
+}
+
+func TestLockedJob(t *testing.T) {
+	useTempDir(t)
+
+	s := newJob(t)
+	if err := s.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if s.Locked() {
+		t.Error("job locked by itself counts as locked")
+	}
+
+	other, err := LoadJob(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Locked() {
+		t.Error("job locked elsewhere is not locked")
+	}
+	if err := other.Lock(); !errors.Is(err, ErrJobLocked) {
+		t.Errorf("Lock of a locked job returned %v", err)
+	}
+	if err := RemoveJob(s.ID); !errors.Is(err, ErrJobLocked) {
+		t.Errorf("RemoveJob of a locked job returned %v", err)
+	}
+
+	if err := s.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := other.Lock(); err != nil {
+		t.Errorf("Lock after Unlock: %v", err)
+	}
+	if err := other.Remove(); err != nil {
+		t.Errorf("Remove by the lock holder: %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// AssetStore keeps the per-asset records of a job on disk: which archive
+// entries were uploaded, the Immich asset each became, and the content
+// already uploaded. Large libraries have hundreds of thousands of entries,
+// too many to rewrite with the job state on every save.
+type AssetStore interface {
+	// Uploaded reports whether an archive entry was uploaded
+	Uploaded(entryID string) bool
+
+	// Asset returns the Immich asset an archive entry was uploaded as
+	Asset(entryID string) (AssetRecord, bool)
+
+	// AssetByHash returns the Immich asset of content with the given SHA-1
+	AssetByHash(hash string) (string, bool)
+
+	// Stacked reports whether the job stacked assets under the asset
+	Stacked(assetID string) bool
+
+	// CreatedAssetIDs returns the IDs of the assets the job created, sorted
+	CreatedAssetIDs() []string
+
+	// Len returns the number of uploaded entries
+	Len() int
+
+	// Append adds a record and syncs it to disk
+	Append(r *Record) error
+
+	// Compact rewrites the store without superseded records, if that is
+	// worth it. All records must be in the saved job state, whose last record
+	// is seq.
+	Compact(seq int64) error
+
+	// RenameEntries changes entry IDs and rewrites the store if any changed,
+	// like Compact. It returns the number of entries renamed.
+	RenameEntries(rename func(entryID string) string, seq int64) (int, error)
+
+	// Close closes the store
+	Close() error
+}
+
+// Record is what finishing one asset changed. Records are numbered; the job
+// state remembers the last one it includes, so the records after it can be
+// replayed after a crash.
+type Record struct {
+	Seq int64 `json:"seq"`
+
+	// Per-asset tracking, kept by the store
+	Entries []string               `json:"entries,omitempty"`
+	Assets  map[string]AssetRecord `json:"assets,omitempty"`
+	Hashes  map[string]string      `json:"hashes,omitempty"`
+	Stacks  []string               `json:"stacks,omitempty"`
+	Stacked map[string]string      `json:"stacked,omitempty"` // stack IDs by primary asset ID
+	Forget  []string               `json:"forget,omitempty"`  // IDs of deleted assets
+
+	// Changes to the job state's counters and queues
+	Photos     int                 `json:"photos,omitempty"`
+	Created    int                 `json:"created,omitempty"`
+	Duplicates int                 `json:"duplicates,omitempty"`
+	Replaced   int                 `json:"replaced,omitempty"`
+	Albums     map[string][]string `json:"albums,omitempty"`
+	Tags       map[string][]string `json:"tags,omitempty"`
+	Trash      []string            `json:"trash,omitempty"`
+}
+
+// Records per line when the log is compacted, and records appended before it
+// is worth compacting
+const (
+	compactChunk = 1000
+	compactAfter = 10000
+)
+
+// logStore is an AssetStore in a journal of records, indexed in memory when
+// opened
+type logStore struct {
+	journal *journal
+
+	uploaded map[string]bool
+	assets   map[string]AssetRecord
+	hashes   map[string]string
+	stacks   []string
+	stacked  map[string]string
+
+	// appended counts the records since the log was last compacted
+	appended int
+}
+
+var _ AssetStore = (*logStore)(nil)
+
+// openLogStore opens the log at path, creating it if needed, and calls replay
+// with each record in order
+func openLogStore(path string, replay func(*Record)) (*logStore, error) {
+	s := &logStore{
+		uploaded: make(map[string]bool),
+		assets:   make(map[string]AssetRecord),
+		hashes:   make(map[string]string),
+		stacked:  make(map[string]string),
+	}
+
+	j, err := openJournal(path, func(data []byte) error {
+		var r Record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		s.apply(&r)
+		s.appended++
+		if replay != nil {
+			replay(&r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open asset store: %w", err)
+	}
+	s.journal = j
+	return s, nil
+}
+
+func (s *logStore) apply(r *Record) {
+	for _, e := range r.Entries {
+		s.uploaded[e] = true
+	}
+	for e, record := range r.Assets {
+		s.assets[e] = record
+	}
+	for hash, id := range r.Hashes {
+		s.hashes[hash] = id
+	}
+	s.stacks = append(s.stacks, r.Stacks...)
+	for primary, id := range r.Stacked {
+		s.stacked[primary] = id
+	}
+
+	if len(r.Forget) > 0 {
+		gone := make(map[string]bool, len(r.Forget))
+		for _, id := range r.Forget {
+			gone[id] = true
+		}
+		for e, record := range s.assets {
+			if gone[record.ID] {
+				delete(s.assets, e)
+			}
+		}
+		for hash, id := range s.hashes {
+			if gone[id] {
+				delete(s.hashes, hash)
+			}
+		}
+		for primary := range s.stacked {
+			if gone[primary] {
+				delete(s.stacked, primary)
+			}
+		}
+	}
+}
+
+func (s *logStore) Uploaded(entryID string) bool {
+	return s.uploaded[entryID]
+}
+
+func (s *logStore) Asset(entryID string) (AssetRecord, bool) {
+	record, ok := s.assets[entryID]
+	return record, ok
+}
+
+func (s *logStore) AssetByHash(hash string) (string, bool) {
+	id, ok := s.hashes[hash]
+	return id, ok
+}
+
+func (s *logStore) Stacked(assetID string) bool {
+	_, ok := s.stacked[assetID]
+	return ok
+}
+
+func (s *logStore) CreatedAssetIDs() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, record := range s.assets {
+		if record.Status != AssetCreated || seen[record.ID] {
+			continue
+		}
+		seen[record.ID] = true
+		ids = append(ids, record.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *logStore) Len() int {
+	return len(s.uploaded)
+}
+
+func (s *logStore) Append(r *Record) error {
+	if err := s.journal.append(r); err != nil {
+		return fmt.Errorf("failed to write asset store: %w", err)
+	}
+	s.apply(r)
+	s.appended++
+	return nil
+}
+
+func (s *logStore) Compact(seq int64) error {
+	if s.appended < compactAfter {
+		return nil
+	}
+	return s.rewrite(seq)
+}
+
+func (s *logStore) RenameEntries(rename func(entryID string) string, seq int64) (int, error) {
+	renamed := 0
+	uploaded := make(map[string]bool, len(s.uploaded))
+	for e := range s.uploaded {
+		if n := rename(e); n != e {
+			e = n
+			renamed++
+		}
+		uploaded[e] = true
+	}
+	assets := make(map[string]AssetRecord, len(s.assets))
+	for e, record := range s.assets {
+		if n := rename(e); n != e {
+			e = n
+			renamed++
+		}
+		assets[e] = record
+	}
+	if renamed == 0 {
+		return 0, nil
+	}
+
+	s.uploaded, s.assets = uploaded, assets
+	return renamed, s.rewrite(seq)
+}
+
+// rewrite replaces the log with the fewest records that hold its index
+func (s *logStore) rewrite(seq int64) error {
+	var records []*Record
+	chunk := func() *Record {
+		if n := len(records); n > 0 && len(records[n-1].Entries)+len(records[n-1].Assets)+len(records[n-1].Hashes) < compactChunk {
+			return records[n-1]
+		}
+		r := &Record{Seq: seq}
+		records = append(records, r)
+		return r
+	}
+	for _, e := range sortedKeys(s.uploaded) {
+		r := chunk()
+		r.Entries = append(r.Entries, e)
+	}
+	for _, e := range sortedKeys(s.assets) {
+		r := chunk()
+		if r.Assets == nil {
+			r.Assets = make(map[string]AssetRecord)
+		}
+		r.Assets[e] = s.assets[e]
+	}
+	for _, hash := range sortedKeys(s.hashes) {
+		r := chunk()
+		if r.Hashes == nil {
+			r.Hashes = make(map[string]string)
+		}
+		r.Hashes[hash] = s.hashes[hash]
+	}
+	if len(s.stacks) > 0 || len(s.stacked) > 0 {
+		records = append(records, &Record{Seq: seq, Stacks: s.stacks, Stacked: s.stacked})
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := s.journal.replace(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to compact asset store: %w", err)
+	}
+	s.appended = len(records)
+	return nil
+}
+
+func (s *logStore) Close() error {
+	return s.journal.close()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,331 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OpenUploadState returns the upload state with its asset store open,
+// creating both if needed. Records the saved state does not include yet, from
+// a crash between saves, are replayed over it. Close the job state when done.
+func (s *JobState) OpenUploadState() (*UploadState, error) {
+	if s.UploadState == nil {
+		s.UploadState = &UploadState{}
+	}
+	u := s.UploadState
+	if u.store != nil {
+		return u, nil
+	}
+
+	path, err := s.storePath()
+	if err != nil {
+		return nil, err
+	}
+	store, err := openLogStore(path, func(r *Record) {
+		if r.Seq > s.JournalSeq {
+			s.replay(r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.store = store
+	return u, nil
+}
+
+// replay applies the counters and queues of a record the saved state does
+// not include
+func (s *JobState) replay(r *Record) {
+	u := s.UploadState
+	u.UploadedPhotos += r.Photos
+	u.CreatedAssets += r.Created
+	u.DuplicateAssets += r.Duplicates
+	u.ReplacedAssets += r.Replaced
+	for album, ids := range r.Albums {
+		for _, id := range ids {
+			u.PendingAlbums = appendQueue(u.PendingAlbums, album, id)
+		}
+	}
+	for tag, ids := range r.Tags {
+		for _, id := range ids {
+			u.PendingTags = appendQueue(u.PendingTags, tag, id)
+		}
+	}
+	u.PendingTrash = append(u.PendingTrash, r.Trash...)
+	s.JournalSeq = r.Seq
+}
+
+// migrateUploads moves the per-asset tracking of an old state file into the
+// asset store
+func (s *JobState) migrateUploads() error {
+	u := s.UploadState
+	if u == nil || len(u.UploadedFiles) == 0 && len(u.Assets) == 0 && len(u.AssetHashes) == 0 && len(u.StackIDs) == 0 {
+		return nil
+	}
+
+	s.JournalSeq++
+	r := &Record{
+		Seq:     s.JournalSeq,
+		Entries: u.UploadedFiles,
+		Assets:  u.Assets,
+		Hashes:  u.AssetHashes,
+		Stacks:  u.StackIDs,
+	}
+	if err := u.store.Append(r); err != nil {
+		return fmt.Errorf("failed to migrate upload state: %w", err)
+	}
+	u.UploadedFiles, u.Assets, u.AssetHashes, u.StackIDs = nil, nil, nil, nil
+	return nil
+}
+
+// EntryID identifies a file inside a Takeout archive in the asset store. The
+// archive is identified by its Drive file ID, which stays the same wherever
+// the archive is downloaded to.
+func EntryID(driveID, name string) string {
+	return driveID + ":" + name
+}
+
+// migrateEntryIDs rewrites the entry IDs of jobs from before EntryID, which
+// started with the local path of the archive
+func (s *JobState) migrateEntryIDs() error {
+	if s.UploadState == nil {
+		return nil
+	}
+	rename := func(id string) string {
+		for _, f := range s.Files {
+			if f.DriveID == "" {
+				continue
+			}
+			if f.LocalPath != "" && strings.HasPrefix(id, f.LocalPath+":") {
+				return EntryID(f.DriveID, strings.TrimPrefix(id, f.LocalPath+":"))
+			}
+			// The archive may have been moved since; match it by file name
+			if prefix := archivePrefix(id); prefix != "" && archiveBase(prefix) == f.Name {
+				return EntryID(f.DriveID, strings.TrimPrefix(id, prefix+":"))
+			}
+		}
+		return id
+	}
+
+	// Save first, so the records replayed when the store was opened are not
+	// replayed again once the store is rewritten
+	if err := s.Save(); err != nil {
+		return err
+	}
+	if _, err := s.UploadState.store.RenameEntries(rename, s.JournalSeq); err != nil {
+		return fmt.Errorf("failed to migrate upload state: %w", err)
+	}
+	return nil
+}
+
+// archivePrefix returns the archive path an old-style entry ID starts with,
+// e.g. "/home/me/takeout-001.zip" for "/home/me/takeout-001.zip:Takeout/a.jpg"
+func archivePrefix(id string) string {
+	i := strings.Index(strings.ToLower(id), ".zip:")
+	if i < 0 {
+		return ""
+	}
+	return id[:i+len(".zip")]
+}
+
+// archiveBase returns the file name of an archive path from any platform
+func archiveBase(p string) string {
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+// Close closes the asset store
+func (s *JobState) Close() error {
+	if s.UploadState == nil || s.UploadState.store == nil {
+		return nil
+	}
+	err := s.UploadState.store.Close()
+	s.UploadState.store = nil
+	return err
+}
+
+// ResetUploads forgets everything uploaded so far, so the next run uploads
+// every entry again
+func (s *JobState) ResetUploads() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	s.UploadState = nil
+
+	path, err := s.storePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// changes returns the record the upload state changes since the last one go
+// into, creating it if needed
+func (u *UploadState) changes() *Record {
+	if u.pending == nil {
+		u.pending = &Record{}
+	}
+	return u.pending
+}
+
+// Uploaded reports whether an archive entry was uploaded
+func (u *UploadState) Uploaded(entryID string) bool {
+	return u.store.Uploaded(entryID)
+}
+
+// Asset returns the Immich asset an archive entry was uploaded as
+func (u *UploadState) Asset(entryID string) (AssetRecord, bool) {
+	if record, ok := u.pending.assets()[entryID]; ok {
+		return record, true
+	}
+	return u.store.Asset(entryID)
+}
+
+// AssetByHash returns the Immich asset content with the given SHA-1 was
+// uploaded as
+func (u *UploadState) AssetByHash(hash string) (string, bool) {
+	if id, ok := u.pending.hashes()[hash]; ok {
+		return id, true
+	}
+	return u.store.AssetByHash(hash)
+}
+
+// CreatedAssetIDs returns the IDs of the assets this job created
+func (u *UploadState) CreatedAssetIDs() []string {
+	return u.store.CreatedAssetIDs()
+}
+
+// RecordAsset remembers the Immich asset an archive entry was uploaded as. The
+// first time an entry is recorded, it counts as new, duplicate or replaced
+// once marked as uploaded.
+func (u *UploadState) RecordAsset(entryID string, record AssetRecord) {
+	c := u.changes()
+	if _, ok := u.Asset(entryID); !ok {
+		switch record.Status {
+		case AssetCreated:
+			c.Created++
+		case AssetDuplicate:
+			c.Duplicates++
+		case AssetReplaced:
+			c.Replaced++
+		}
+	}
+	if c.Assets == nil {
+		c.Assets = make(map[string]AssetRecord)
+	}
+	c.Assets[entryID] = record
+}
+
+// RecordHash remembers the asset content with the given SHA-1 was uploaded as
+func (u *UploadState) RecordHash(hash, assetID string) {
+	c := u.changes()
+	if c.Hashes == nil {
+		c.Hashes = make(map[string]string)
+	}
+	c.Hashes[hash] = assetID
+}
+
+// AddStack remembers a stack the job created under a primary asset
+func (u *UploadState) AddStack(primaryAssetID, stackID string) {
+	c := u.changes()
+	c.Stacks = append(c.Stacks, stackID)
+	if c.Stacked == nil {
+		c.Stacked = make(map[string]string)
+	}
+	c.Stacked[primaryAssetID] = stackID
+}
+
+// Stacked reports whether the job stacked assets under the asset
+func (u *UploadState) Stacked(assetID string) bool {
+	if _, ok := u.pending.stacked()[assetID]; ok {
+		return true
+	}
+	return u.store.Stacked(assetID)
+}
+
+// QueueAlbumAdd remembers to add an asset to an album
+func (u *UploadState) QueueAlbumAdd(album, assetID string) {
+	c := u.changes()
+	c.Albums = appendQueue(c.Albums, album, assetID)
+	u.PendingAlbums = appendQueue(u.PendingAlbums, album, assetID)
+}
+
+// QueueTag remembers to tag an asset
+func (u *UploadState) QueueTag(tag, assetID string) {
+	c := u.changes()
+	c.Tags = appendQueue(c.Tags, tag, assetID)
+	u.PendingTags = appendQueue(u.PendingTags, tag, assetID)
+}
+
+// QueueTrash remembers to move an asset to the trash
+func (u *UploadState) QueueTrash(assetID string) {
+	c := u.changes()
+	c.Trash = append(c.Trash, assetID)
+	u.PendingTrash = append(u.PendingTrash, assetID)
+}
+
+func (r *Record) assets() map[string]AssetRecord {
+	if r == nil {
+		return nil
+	}
+	return r.Assets
+}
+
+func (r *Record) stacked() map[string]string {
+	if r == nil {
+		return nil
+	}
+	return r.Stacked
+}
+
+func (r *Record) hashes() map[string]string {
+	if r == nil {
+		return nil
+	}
+	return r.Hashes
+}
+
+func appendQueue(queue map[string][]string, key, assetID string) map[string][]string {
+	if queue == nil {
+		queue = make(map[string][]string)
+	}
+	queue[key] = append(queue[key], assetID)
+	return queue
+}
+
+// MarkUploaded records archive entries as uploaded, and writes them to the
+// asset store together with the other upload state changes since the last
+// call. Once it returns, the entries count as uploaded even after a crash.
+func (s *JobState) MarkUploaded(entryIDs []string, photos int) error {
+	u := s.UploadState
+	r := u.changes()
+	u.pending = nil
+
+	s.JournalSeq++
+	r.Seq = s.JournalSeq
+	r.Entries = entryIDs
+	r.Photos = photos
+	if err := u.store.Append(r); err != nil {
+		return err
+	}
+	u.UploadedPhotos += photos
+	u.CreatedAssets += r.Created
+	u.DuplicateAssets += r.Duplicates
+	u.ReplacedAssets += r.Replaced
+	return nil
+}
+
+// ForgetAssets removes assets deleted from Immich from the asset store
+func (s *JobState) ForgetAssets(assetIDs []string) error {
+	if len(assetIDs) == 0 {
+		return nil
+	}
+	s.JournalSeq++
+	return s.UploadState.store.Append(&Record{Seq: s.JournalSeq, Forget: assetIDs})
+}
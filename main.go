@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -18,21 +19,105 @@ import (
 	"github.com/davidaniva/immich-importer/internal/downloader"
 	"github.com/davidaniva/immich-importer/internal/google"
 	"github.com/davidaniva/immich-importer/internal/importer"
+	"github.com/davidaniva/immich-importer/internal/preflight"
 	"github.com/davidaniva/immich-importer/internal/state"
 )
 
+const takeoutURL = "https://takeout.google.com/settings/takeout/custom/photos"
+
 func main() {
-	serverURL := flag.String("server", "", "Immich server URL")
-	apiKey := flag.String("api-key", "", "Immich API key")
-	flag.Parse()
+	// Subcommands; anything else (including no arguments) runs the interactive flow
+	if len(os.Args) > 1 {
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			cmd.run(os.Args[2:])
+			return
+		}
+	}
+
+	runInteractive(os.Args[1:])
+}
+
+// runInteractive is the default guided flow: set up, choose what to do, import
+func runInteractive(args []string) {
+	fs := flag.NewFlagSet("immich-importer", flag.ExitOnError)
+	fs.Usage = printUsage
+	serverURL := fs.String("server", "", "Immich server URL")
+	apiKey := fs.String("api-key", "", "Immich API key")
+	token := fs.String("token", "", "Setup token from Immich server")
+	importOpts := addImportFlags(fs)
+	fs.Parse(args)
+	options := importOpts.options()
+
+	printBanner()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	cfg := setupConfig(*serverURL, *apiKey, *token)
+
+	// Try to load existing state
+	jobState, err := state.Load()
+	if err != nil {
+		exitLoadError(err)
+	}
+	// A finished job is kept as it is; importing again starts a new job
+	if jobState != nil && jobState.Finished() {
+		jobState = nil
+	}
+	if jobState != nil && jobState.Status != "idle" {
+		fmt.Printf("Found existing import job (status: %s)\n", jobState.Status)
+		if !confirm("Resume previous import?", true) {
+			jobState = nil
+		}
+	}
+
+	// If no existing job, ask what user wants to do
+	wantsTakeout := false
+	if jobState == nil || len(jobState.Files) == 0 {
+		fmt.Println()
+		fmt.Println("What would you like to do?")
+		fmt.Println("  [1] Request a new Google Takeout export")
+		fmt.Println("  [2] Import existing Takeout files from Drive")
+		fmt.Println()
+		fmt.Print("Choice [1/2]: ")
+		choice := readLine()
+		wantsTakeout = (choice == "1" || choice == "")
+	}
+
+	redirectURL := ""
+	if wantsTakeout {
+		redirectURL = takeoutURL
+	}
+	googleClient := connectGoogle(cfg, redirectURL)
 
+	// If user wanted Takeout, open browser and show instructions
+	if wantsTakeout {
+		fmt.Println()
+		fmt.Println("Opening Google Takeout...")
+		if err := openBrowser(takeoutURL); err != nil {
+			fmt.Printf("Could not open browser. Please open: %s\n", takeoutURL)
+		}
+		showTakeoutInstructions()
+		os.Exit(0)
+	}
+
+	if jobState == nil || len(jobState.Files) == 0 {
+		jobState = newJob(cfg, googleClient, false)
+	}
+
+	startImport(ctx, cfg, jobState, googleClient, options)
+}
+
+func printBanner() {
 	fmt.Println("Immich Google Photos Importer")
 	fmt.Println("==============================")
 	fmt.Println()
+}
 
-	// Set up signal handling for graceful shutdown
+// signalContext returns a context that is cancelled on the first Ctrl+C;
+// a second Ctrl+C force quits
+func signalContext() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -45,85 +130,127 @@ func main() {
 		os.Exit(1)
 	}()
 
-	// Try to load existing config
+	return ctx, cancel
+}
+
+// setupConfig loads the stored config, or fetches one from the server using a
+// setup token or a setup token created from the given API key
+func setupConfig(serverURL, apiKey, token string) *config.Config {
+	// Try to load existing config. Only a missing config is set up again:
+	// anything else would overwrite credentials that may still be needed.
 	cfg, err := config.Load()
 	if err != nil {
-		fmt.Printf("Note: Could not load existing config: %v\n", err)
+		fmt.Printf("Error: Could not load existing config: %v\n", err)
+		if errors.Is(err, config.ErrWrongPassphrase) {
+			fmt.Printf("Run again with the passphrase the config was saved with, or set %s.\n", config.PassphraseEnv)
+		}
+		if path, err := config.GetConfigPath(); err == nil {
+			fmt.Printf("To set up from scratch instead, delete %s and run setup again.\n", path)
+		}
+		os.Exit(1)
+	}
+
+	if cfg != nil {
+		fmt.Printf("Using existing configuration for: %s\n", cfg.ServerURL)
+		return cfg
 	}
 
 	// If no config, need to set up
-	if cfg == nil {
-		if *serverURL == "" || *apiKey == "" {
-			fmt.Println("No existing configuration found.")
-			fmt.Println("Usage: immich-importer --server URL --api-key KEY")
-			fmt.Println()
-			fmt.Println("Get your API key from Immich: User Settings > API Keys > New API Key")
+	if serverURL == "" || (apiKey == "" && token == "") {
+		fmt.Println("No existing configuration found.")
+		fmt.Println("Usage: immich-importer --server URL --token SETUP_TOKEN")
+		fmt.Println("   or: immich-importer --server URL --api-key KEY")
+		fmt.Println()
+		fmt.Println("Get a setup token from Immich: Utilities > Import from Google Photos")
+		fmt.Println("Or an API key from Immich: User Settings > API Keys > New API Key")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Connecting to %s...\n", serverURL)
+
+	serverURL, err = preflight.Discover(context.Background(), serverURL)
+	if err != nil {
+		printError("Could not reach server", err)
+		os.Exit(1)
+	}
+
+	if token != "" {
+		fmt.Println("Fetching configuration...")
+		cfg, err = config.FetchFromServer(serverURL, token)
+		if errors.Is(err, config.ErrSetupTokenInvalid) {
+			fmt.Println("The setup token was not accepted by the server.")
+			fmt.Println("Setup tokens expire after 30 days and can only be used with the server that issued them.")
+			if apiKey == "" {
+				fmt.Println()
+				fmt.Println("Generate a new token in Immich (Utilities > Import from Google Photos),")
+				fmt.Println("or pass --api-key KEY to create one automatically.")
+				os.Exit(1)
+			}
+			fmt.Println("Creating a new setup token from the API key instead.")
+			cfg, err = nil, nil
+		}
+		if err != nil {
+			fmt.Printf("Error: Failed to fetch config: %v\n", err)
 			os.Exit(1)
 		}
+	}
 
-		fmt.Printf("Connecting to %s...\n", *serverURL)
-
+	if cfg == nil {
 		// Create setup token using API key
 		fmt.Println("Creating setup token...")
-		setupToken, err := config.CreateSetupToken(*serverURL, *apiKey)
+		setupToken, err := config.CreateSetupToken(serverURL, apiKey)
+		if errors.Is(err, config.ErrAPIKeyRejected) {
+			fmt.Println("The API key was rejected by the server.")
+			fmt.Println("Check that it was copied completely and has not been deleted in")
+			fmt.Println("Immich (User Settings > API Keys).")
+			os.Exit(1)
+		}
 		if err != nil {
 			fmt.Printf("Error: Failed to create setup token: %v\n", err)
 			os.Exit(1)
 		}
 
 		fmt.Println("Fetching configuration...")
-		cfg, err = config.FetchFromServer(*serverURL, setupToken)
+		cfg, err = config.FetchFromServer(serverURL, setupToken)
 		if err != nil {
 			fmt.Printf("Error: Failed to fetch config: %v\n", err)
 			os.Exit(1)
 		}
-
-		if err := cfg.Save(); err != nil {
-			fmt.Printf("Warning: Could not save config: %v\n", err)
-		}
-		fmt.Println("Configuration saved.")
-	} else {
-		fmt.Printf("Using existing configuration for: %s\n", cfg.ServerURL)
 	}
 
-	// Try to load existing state
-	jobState, _ := state.Load()
-	if jobState != nil && jobState.Status != "complete" && jobState.Status != "idle" {
-		fmt.Printf("Found existing import job (status: %s)\n", jobState.Status)
-		fmt.Print("Resume previous import? [Y/n]: ")
-		reader := bufio.NewReader(os.Stdin)
-		answer, _ := reader.ReadString('\n')
-		answer = strings.TrimSpace(strings.ToLower(answer))
-		if answer != "" && answer != "y" && answer != "yes" {
-			jobState = nil
-		}
+	// Keep the URL we just reached; the one the server reports may only be
+	// reachable from inside its own network
+	cfg.ServerURL = serverURL
+
+	if err := cfg.Save(); err != nil {
+		fmt.Printf("Warning: Could not save config: %v\n", err)
 	}
+	fmt.Println("Configuration saved.")
 
-	// If no existing job, ask what user wants to do
-	wantsTakeout := false
-	if jobState == nil || len(jobState.Files) == 0 {
-		fmt.Println()
-		fmt.Println("What would you like to do?")
-		fmt.Println("  [1] Request a new Google Takeout export")
-		fmt.Println("  [2] Import existing Takeout files from Drive")
-		fmt.Println()
-		fmt.Print("Choice [1/2]: ")
-		reader := bufio.NewReader(os.Stdin)
-		choice, _ := reader.ReadString('\n')
-		choice = strings.TrimSpace(choice)
-		wantsTakeout = (choice == "1" || choice == "")
+	return cfg
+}
+
+// loadConfig loads the stored config for commands that require an existing setup
+func loadConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error: Could not load config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg == nil {
+		fmt.Println("No existing configuration found. Run immich-importer --server URL --token SETUP_TOKEN first.")
+		os.Exit(1)
 	}
+	return cfg
+}
 
-	// Check Google auth
+// connectGoogle authorizes Google Drive access if needed and returns a client
+func connectGoogle(cfg *config.Config, redirectURL string) *google.Client {
 	if !cfg.HasGoogleTokens() {
 		fmt.Println()
 		fmt.Println("=== Connect Google Drive ===")
 		fmt.Println()
 		fmt.Println("Connecting your Google account...")
-		redirectURL := ""
-		if wantsTakeout {
-			redirectURL = "https://takeout.google.com/settings/takeout/custom/photos"
-		}
 		if err := doGoogleAuthWithRedirect(cfg, redirectURL); err != nil {
 			fmt.Printf("Error: Google authentication failed: %v\n", err)
 			os.Exit(1)
@@ -131,19 +258,6 @@ func main() {
 		fmt.Println("Google account connected!")
 	}
 
-	// If user wanted Takeout, open browser and show instructions
-	if wantsTakeout {
-		takeoutURL := "https://takeout.google.com/settings/takeout/custom/photos"
-		fmt.Println()
-		fmt.Println("Opening Google Takeout...")
-		if err := openBrowser(takeoutURL); err != nil {
-			fmt.Printf("Could not open browser. Please open: %s\n", takeoutURL)
-		}
-		showTakeoutInstructions()
-		os.Exit(0)
-	}
-
-	// Create Google client
 	googleClient, err := google.NewClientFromTokens(
 		cfg.OAuth,
 		cfg.GoogleAccessToken,
@@ -154,44 +268,55 @@ func main() {
 		fmt.Printf("Error: Failed to create Google client: %v\n", err)
 		os.Exit(1)
 	}
+	return googleClient
+}
 
-	// List files from Drive
-	if jobState == nil || len(jobState.Files) == 0 {
+// listTakeoutFiles lists Takeout files in Drive, explaining what to do if there are none
+func listTakeoutFiles(googleClient *google.Client) []google.DriveFile {
+	fmt.Println()
+	fmt.Println("Searching for Google Takeout files in your Drive...")
+	files, err := googleClient.ListTakeoutFiles()
+	if err != nil {
+		fmt.Printf("Error: Failed to list files: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No Takeout files found in your Google Drive.")
 		fmt.Println()
-		fmt.Println("Searching for Google Takeout files in your Drive...")
-		files, err := googleClient.ListTakeoutFiles()
-		if err != nil {
-			fmt.Printf("Error: Failed to list files: %v\n", err)
-			os.Exit(1)
-		}
+		fmt.Println("Possible reasons:")
+		fmt.Println("  - The export is still being prepared (check your email for completion)")
+		fmt.Println("  - You selected 'Send download link via email' instead of 'Add to Drive'")
+		fmt.Println("  - The Takeout files are in a different Google account")
+		fmt.Println()
+		fmt.Println("To request a new export with Google Photos only:")
+		fmt.Printf("  %s\n", takeoutURL)
+		os.Exit(0)
+	}
 
-		if len(files) == 0 {
-			fmt.Println("No Takeout files found in your Google Drive.")
-			fmt.Println()
-			fmt.Println("Possible reasons:")
-			fmt.Println("  - The export is still being prepared (check your email for completion)")
-			fmt.Println("  - You selected 'Send download link via email' instead of 'Add to Drive'")
-			fmt.Println("  - The Takeout files are in a different Google account")
-			fmt.Println()
-			fmt.Println("To request a new export with Google Photos only:")
-			fmt.Println("  https://takeout.google.com/settings/takeout/custom/photos")
-			os.Exit(0)
-		}
+	fmt.Printf("\nFound %d Takeout file(s):\n", len(files))
+	var totalSize int64
+	for i, f := range files {
+		fmt.Printf("  [%d] %s (%.2f MB)\n", i+1, f.Name, float64(f.Size)/1024/1024)
+		totalSize += f.Size
+	}
+	fmt.Printf("\nTotal: %.2f MB\n", float64(totalSize)/1024/1024)
 
-		fmt.Printf("\nFound %d Takeout file(s):\n", len(files))
-		var totalSize int64
-		for i, f := range files {
-			fmt.Printf("  [%d] %s (%.2f MB)\n", i+1, f.Name, float64(f.Size)/1024/1024)
-			totalSize += f.Size
-		}
-		fmt.Printf("\nTotal: %.2f MB\n", float64(totalSize)/1024/1024)
+	return files
+}
+
+// newJob lets the user pick Takeout files and creates a job for them.
+// If all is set, every file is selected without prompting.
+func newJob(cfg *config.Config, googleClient *google.Client, all bool) *state.JobState {
+	files := listTakeoutFiles(googleClient)
 
+	var selectedFiles []google.DriveFile
+	if all {
+		selectedFiles = files
+	} else {
 		fmt.Print("\nImport all files? [Y/n] (or enter specific numbers comma-separated): ")
-		reader := bufio.NewReader(os.Stdin)
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
+		input := readLine()
 
-		var selectedFiles []google.DriveFile
 		if input == "" || strings.ToLower(input) == "y" || strings.ToLower(input) == "yes" || strings.ToLower(input) == "all" {
 			selectedFiles = files
 		} else if strings.ToLower(input) == "n" || strings.ToLower(input) == "no" {
@@ -208,33 +333,45 @@ func main() {
 				selectedFiles = append(selectedFiles, files[num-1])
 			}
 		}
+	}
 
-		if len(selectedFiles) == 0 {
-			fmt.Println("No files selected. Exiting.")
-			os.Exit(0)
-		}
+	if len(selectedFiles) == 0 {
+		fmt.Println("No files selected. Exiting.")
+		os.Exit(0)
+	}
 
-		// Create new job state
-		jobState = state.New()
-		jobState.ServerURL = cfg.ServerURL
-		for _, f := range selectedFiles {
-			jobState.AddFile(f.ID, f.Name, f.Size)
-		}
-		jobState.Save()
+	// Create new job state
+	jobState := state.New()
+	jobState.ServerURL = cfg.ServerURL
+	for _, f := range selectedFiles {
+		jobState.AddFile(f.ID, f.Name, f.Size)
 	}
+	jobState.Save()
+
+	return jobState
+}
 
-	// Start import
+// startImport runs the job and reports the outcome
+func startImport(ctx context.Context, cfg *config.Config, jobState *state.JobState, googleClient *google.Client, options importer.Options) {
 	fmt.Println()
 	fmt.Println("Starting import...")
 	fmt.Println("(Press Ctrl+C to pause - you can resume later)")
 	fmt.Println()
 
-	if err := runImport(ctx, cfg, jobState, googleClient); err != nil {
+	if err := runImport(ctx, cfg, jobState, googleClient, options); err != nil {
+		if errors.Is(err, state.ErrJobLocked) {
+			fmt.Printf("Error: Import job %s is already running in another process.\n", jobState.ID)
+			os.Exit(1)
+		}
 		if ctx.Err() != nil {
 			fmt.Println("\nImport paused. Run again to resume.")
 			os.Exit(0)
 		}
-		fmt.Printf("Error: Import failed: %v\n", err)
+		jobState.Status = "error"
+		jobState.LastError = err.Error()
+		jobState.Save()
+		printError("Import failed", err)
+		fmt.Printf("Run 'immich-importer jobs resume %s' to try again.\n", jobState.ID)
 		os.Exit(1)
 	}
 
@@ -283,12 +420,64 @@ func doGoogleAuthWithRedirect(cfg *config.Config, redirectURL string) error {
 	return cfg.Save()
 }
 
-func runImport(ctx context.Context, cfg *config.Config, jobState *state.JobState, googleClient *google.Client) error {
+// printError prints an error, with the advice attached to a failed preflight check
+func printError(what string, err error) {
+	fmt.Printf("Error: %s: %v\n", what, err)
+
+	var checkErr *preflight.Error
+	if errors.As(err, &checkErr) && checkErr.Hint != "" {
+		fmt.Printf("  %s\n", checkErr.Hint)
+	}
+}
+
+// checkServer resolves the configured server URL and runs the preflight checks
+func checkServer(ctx context.Context, cfg *config.Config, options importer.Options) (*preflight.Result, error) {
+	serverURL, err := preflight.Discover(ctx, cfg.ServerURL)
+	if err != nil {
+		return nil, err
+	}
+	if serverURL != cfg.ServerURL {
+		fmt.Printf("Server URL resolved to %s\n", serverURL)
+		cfg.ServerURL = serverURL
+		if err := cfg.Save(); err != nil {
+			fmt.Printf("Warning: Could not save config: %v\n", err)
+		}
+	}
+
+	result, err := preflight.Run(ctx, serverURL, cfg.APIKey, options.Permissions())
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Connected to Immich %s at %s\n", result.Version, result.ServerURL)
+
+	return result, nil
+}
+
+func runImport(ctx context.Context, cfg *config.Config, jobState *state.JobState, googleClient *google.Client, options importer.Options) error {
+	// Only one process may run a job; the lock is released when it exits
+	if err := jobState.Lock(); err != nil {
+		return err
+	}
+	defer jobState.Unlock()
+
+	// Check the server before downloading anything
+	server, err := checkServer(ctx, cfg, options)
+	if err != nil {
+		return err
+	}
+	jobState.ServerURL = cfg.ServerURL
+
 	// Phase 1: Download
 	jobState.Status = "downloading"
+	jobState.LastError = ""
 	jobState.Save()
 
+	downloadDir, err := config.GetJobDownloadDir(jobState.ID)
+	if err != nil {
+		return err
+	}
 	dl := downloader.New(googleClient)
+	dl.SetDir(downloadDir)
 	for i := range jobState.Files {
 		select {
 		case <-ctx.Done():
@@ -319,24 +508,124 @@ func runImport(ctx context.Context, cfg *config.Config, jobState *state.JobState
 	fmt.Println()
 	fmt.Println("Uploading to Immich...")
 
-	imp := importer.New(cfg.ServerURL, cfg.APIKey)
+	imp := importer.New(cfg.ServerURL, cfg.APIKey, options)
+	imp.SetMediaTypes(importer.MediaTypes{
+		Image:   server.MediaTypes.Image,
+		Video:   server.MediaTypes.Video,
+		Sidecar: server.MediaTypes.Sidecar,
+	})
 	progress := func(phase string, current, total int, currentFile string) {
 		if currentFile != "" {
-			fmt.Printf("\r[%d/%d] %s", current, total, truncate(currentFile, 50))
+			us := jobState.UploadState
+			fmt.Printf("\r[%d/%d] %d new, %d duplicate - %s", current, total, us.CreatedAssets, us.DuplicateAssets, truncate(currentFile, 40))
 		}
 	}
 
-	if err := imp.ImportFiles(ctx, jobState, progress); err != nil {
+	err = imp.ImportFiles(ctx, jobState, progress)
+	fmt.Println()
+	if us := jobState.UploadState; us != nil {
+		fmt.Printf("Uploaded %d new asset(s); %d were already in Immich or duplicates of another file.\n", us.CreatedAssets, us.DuplicateAssets)
+		if us.ReplacedAssets > 0 {
+			fmt.Printf("%d upload(s) replaced the file of an existing asset.\n", us.ReplacedAssets)
+		}
+	}
+	printReport(imp.Report())
+	writeUndatedReport(jobState, imp.Report())
+	if err != nil {
 		return fmt.Errorf("upload failed: %w", err)
 	}
 
-	fmt.Println()
 	jobState.Status = "complete"
 	jobState.Save()
 
 	return nil
 }
 
+// printReport lists the archive entries that were skipped
+func printReport(report *importer.Report) {
+	if count := report.UnsupportedCount(); count > 0 {
+		fmt.Printf("Skipped %d file(s) of types Immich does not support:\n", count)
+		for _, ext := range report.UnsupportedExtensions() {
+			names := report.Unsupported[ext]
+			fmt.Printf("  %-8s %d (e.g. %s)\n", ext, len(names), names[0])
+		}
+	}
+	if len(report.Trashed) > 0 {
+		fmt.Printf("Skipped %d item(s) from the Google Photos trash (use --trashed trash to import them).\n", len(report.Trashed))
+	}
+}
+
+// writeUndatedReport lists the assets uploaded without a known capture date
+// in a file in the job's directory, so their dates can be fixed by hand in
+// Immich. A resumed job adds to the list of its earlier runs.
+func writeUndatedReport(jobState *state.JobState, report *importer.Report) {
+	if len(report.Undated) == 0 {
+		return
+	}
+
+	fmt.Printf("Could not determine the capture date of %d asset(s).\n", len(report.Undated))
+	path, err := jobState.ReportPath("undated.txt")
+	if err != nil {
+		fmt.Printf("Warning: failed to write report: %v\n", err)
+		return
+	}
+
+	// Keep the entries of earlier runs; an asset listed again replaces its line
+	var names []string
+	lines := make(map[string]string)
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			name, _, ok := strings.Cut(line, "\t")
+			if !ok || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if _, seen := lines[name]; !seen {
+				names = append(names, name)
+			}
+			lines[name] = line
+		}
+	}
+	for _, a := range report.Undated {
+		if _, seen := lines[a.Name]; !seen {
+			names = append(names, a.Name)
+		}
+		lines[a.Name] = fmt.Sprintf("%s\t%s", a.Name, a.Used.Format(time.RFC3339))
+	}
+
+	var b strings.Builder
+	b.WriteString("# Assets uploaded without a known capture date, and the date used instead\n")
+	for _, name := range names {
+		b.WriteString(lines[name])
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		fmt.Printf("Warning: failed to write report: %v\n", err)
+		return
+	}
+	fmt.Printf("They are listed in %s\n", path)
+}
+
+// readLine reads one trimmed line from stdin
+func readLine() string {
+	reader := bufio.NewReader(os.Stdin)
+	line, _ := reader.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// confirm asks a yes/no question, returning def on an empty answer
+func confirm(question string, def bool) bool {
+	if def {
+		fmt.Printf("%s [Y/n]: ", question)
+	} else {
+		fmt.Printf("%s [y/N]: ", question)
+	}
+	answer := strings.ToLower(readLine())
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
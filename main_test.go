@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidaniva/immich-importer/internal/config"
+	"github.com/davidaniva/immich-importer/internal/google"
+	"github.com/davidaniva/immich-importer/internal/google/drivetest"
+	"github.com/davidaniva/immich-importer/internal/immich"
+	"github.com/davidaniva/immich-importer/internal/immich/immichtest"
+	"github.com/davidaniva/immich-importer/internal/importer"
+	"github.com/davidaniva/immich-importer/internal/importer/takeouttest"
+	"github.com/davidaniva/immich-importer/internal/state"
+)
+
+// testTakeout builds an export with the quirks of real ones and returns it
+// with the capture times the imported assets must have, by file name
+func testTakeout() (*takeouttest.Takeout, map[string]time.Time) {
+	t := takeouttest.New()
+	t.SplitSidecars = true
+	dates := make(map[string]time.Time)
+
+	for n := 1; n <= 10; n++ {
+		taken := time.Date(2019, 6, n, 12, 0, 0, 0, time.UTC)
+		photo := t.AddPhoto("Photos from 2019", fmt.Sprintf("IMG_%04d.JPG", n), taken)
+		dates[photo.Name] = taken
+	}
+
+	// In an album, with people, and edited
+	rome := time.Date(2019, 3, 12, 10, 11, 12, 0, time.UTC)
+	photo := t.AddPhoto("Photos from 2019", "IMG_20190312_101112.jpg", rome)
+	photo.People = []string{"Alice"}
+	photo.Favorite = true
+	t.AddToAlbum(photo, "Trip to Rome")
+	edited := t.AddEdited(photo)
+	dates[photo.Name] = rome
+	dates[edited.Name] = rome
+
+	// A name long enough for Takeout to cut off the sidecar name. The time
+	// in the name is local; the sidecar has the right one.
+	screenshot := time.Date(2019, 4, 1, 6, 30, 0, 0, time.UTC)
+	long := t.AddPhoto("Photos from 2019", "Screenshot_2019-04-01-08-30-00-000_com.example.application.png", screenshot)
+	dates[long.Name] = screenshot
+
+	// A Live Photo
+	live := time.Date(2020, 7, 4, 20, 15, 0, 0, time.UTC)
+	still, video := t.AddLivePhoto("Photos from 2020", "IMG_4321", live)
+	dates[still.Name] = live
+	dates[video.Name] = live
+
+	// No sidecar: the date comes from the file name
+	pixel := t.AddPhoto("Photos from 2020", "PXL_20200105_080910123.jpg", time.Time{})
+	pixel.NoSidecar = true
+	dates[pixel.Name] = time.Date(2020, 1, 5, 8, 9, 10, 0, time.UTC)
+
+	return t, dates
+}
+
+// testEnv points the app data directory at a temporary directory and starts
+// fake Drive and Immich servers, with the Takeout parts in Drive
+func testEnv(t *testing.T, takeout *takeouttest.Takeout) (*config.Config, *google.Client, *drivetest.Server, *immichtest.Server) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("APPDATA", home)
+
+	drive := drivetest.NewServer(t)
+	parts, err := takeout.Parts(3)
+	if err != nil {
+		t.Fatalf("building takeout: %v", err)
+	}
+	for i, data := range parts {
+		drive.AddFile(takeouttest.PartName(i), "application/zip", data)
+	}
+	googleClient, err := google.NewClientWithEndpoints(drive.Endpoints(), drivetest.OAuth, drivetest.AccessToken, drivetest.RefreshToken, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("NewClientWithEndpoints: %v", err)
+	}
+
+	srv := immichtest.NewServer(t)
+	cfg := &config.Config{ServerURL: srv.URL, APIKey: srv.APIKey, OAuth: drivetest.OAuth}
+	return cfg, googleClient, drive, srv
+}
+
+// checkImport checks that every item of the export is an asset with the
+// right capture time, and that the album was created
+func checkImport(t *testing.T, srv *immichtest.Server, dates map[string]time.Time) {
+	t.Helper()
+
+	assets := srv.Assets()
+	if len(assets) != len(dates) {
+		t.Errorf("got %d assets, want %d", len(assets), len(dates))
+	}
+	seen := make(map[string]bool)
+	for _, a := range assets {
+		want, ok := dates[a.Filename]
+		if !ok {
+			t.Errorf("unexpected asset %s", a.Filename)
+			continue
+		}
+		if seen[a.Filename] {
+			t.Errorf("%s uploaded twice", a.Filename)
+		}
+		seen[a.Filename] = true
+		if !a.FileCreatedAt.Equal(want) {
+			t.Errorf("%s: FileCreatedAt = %v, want %v", a.Filename, a.FileCreatedAt, want)
+		}
+	}
+
+	photo, _ := srv.AssetByFilename("IMG_20190312_101112.jpg")
+	if !photo.IsFavorite {
+		t.Errorf("favorite not imported")
+	}
+	var inAlbum bool
+	for _, album := range srv.Albums() {
+		if album.Name != "Trip to Rome" {
+			continue
+		}
+		for _, id := range album.AssetIDs {
+			inAlbum = inAlbum || id == photo.ID
+		}
+	}
+	if !inAlbum {
+		t.Errorf("photo not in album \"Trip to Rome\": %+v", srv.Albums())
+	}
+
+	still, _ := srv.AssetByFilename("IMG_4321.HEIC")
+	video, _ := srv.AssetByFilename("IMG_4321.MP4")
+	if still.LivePhotoVideoID != video.ID {
+		t.Errorf("Live Photo video not linked: still %+v, video %+v", still, video)
+	}
+}
+
+func TestImport(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+
+	jobState := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, jobState, googleClient, importer.Options{}); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+	if jobState.Status != "complete" {
+		t.Errorf("job status = %q, want complete", jobState.Status)
+	}
+	checkImport(t, srv, dates)
+
+	us := jobState.UploadState
+	if us.CreatedAssets != len(dates) || us.DuplicateAssets != 1 {
+		t.Errorf("got %d new and %d duplicate assets, want %d and the album copy", us.CreatedAssets, us.DuplicateAssets, len(dates))
+	}
+
+	// Every job downloads to its own directory
+	downloadDir, err := config.GetJobDownloadDir(jobState.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range jobState.Files {
+		if filepath.Dir(f.LocalPath) != downloadDir {
+			t.Errorf("%s downloaded to %s, want it in %s", f.Name, f.LocalPath, downloadDir)
+		}
+	}
+}
+
+func TestRunningJobIsNotRunAgain(t *testing.T) {
+	takeout, _ := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+
+	jobState := newJob(cfg, googleClient, true)
+	jobState.Save()
+	running, err := state.LoadJob(jobState.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := running.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer running.Unlock()
+
+	err = runImport(context.Background(), cfg, jobState, googleClient, importer.Options{})
+	if !errors.Is(err, state.ErrJobLocked) {
+		t.Fatalf("runImport of a running job returned %v", err)
+	}
+	if jobState.Status != "idle" || len(srv.Assets()) != 0 {
+		t.Errorf("running job was imported again: status %s, %d asset(s)", jobState.Status, len(srv.Assets()))
+	}
+}
+
+func TestTrashedItems(t *testing.T) {
+	takeout, _ := testTakeout()
+	taken := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	trashed := takeout.AddPhoto("Trash", "IMG_TRASHED.jpg", taken)
+	known := takeout.AddPhoto("Trash", "IMG_KNOWN.jpg", taken)
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+	options := importer.Options{Trashed: importer.TrashImport}
+
+	// Immich has one of the trashed photos already, from another device
+	_, err := srv.Client().Upload(context.Background(), &immich.UploadRequest{
+		Filename: known.Name, Content: known.Content, DeviceAssetID: known.Name, DeviceID: "phone",
+		FileCreatedAt: taken, FileModifiedAt: taken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving to the trash fails the first time; the retry still does it
+	srv.FailDeletes(1)
+	jobState := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, jobState, googleClient, options); err == nil {
+		t.Fatal("runImport succeeded although moving to the trash failed")
+	}
+	if err := runImport(context.Background(), cfg, jobState, googleClient, options); err != nil {
+		t.Fatalf("second runImport: %v", err)
+	}
+
+	if a, _ := srv.AssetByFilename(trashed.Name); !a.IsTrashed {
+		t.Errorf("%s not moved to the trash", trashed.Name)
+	}
+	if a, _ := srv.AssetByFilename(known.Name); a.IsTrashed {
+		t.Errorf("%s, which Immich had already, was moved to the trash", known.Name)
+	}
+}
+
+func TestStackCreatedOnRetry(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+
+	// Stacking the edited photo fails after both copies were uploaded
+	srv.FailStacks(1)
+	jobState := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, jobState, googleClient, importer.Options{}); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+	if got := len(srv.Stacks()); got != 0 {
+		t.Fatalf("%d stack(s) created although stacking failed", got)
+	}
+
+	// The next run finds both copies in Immich and still stacks them
+	if err := runImport(context.Background(), cfg, jobState, googleClient, importer.Options{}); err != nil {
+		t.Fatalf("second runImport: %v", err)
+	}
+	checkImport(t, srv, dates)
+	photo, _ := srv.AssetByFilename("IMG_20190312_101112.jpg")
+	edited, _ := srv.AssetByFilename("IMG_20190312_101112-edited.jpg")
+	stacks := srv.Stacks()
+	if len(stacks) != 1 || photo.StackID == "" || photo.StackID != edited.StackID {
+		t.Errorf("edited photo not stacked on retry: %v", stacks)
+	}
+}
+
+func TestImportResumesAfterInterrupt(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, drive, srv := testEnv(t, takeout)
+
+	// The first run loses its connection to Drive halfway through a part,
+	// then is interrupted during the upload
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const interruptAt = 6
+	srv.OnUpload = func(uploads int) {
+		if uploads == interruptAt {
+			cancel()
+		}
+	}
+
+	jobState := newJob(cfg, googleClient, true)
+	drive.DisconnectAfter(jobState.Files[1].DriveID, 1000)
+	if err := runImport(ctx, cfg, jobState, googleClient, importer.Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted runImport returned %v, want context.Canceled", err)
+	}
+	if len(drive.Ranges(jobState.Files[1].DriveID)) != 2 {
+		t.Errorf("dropped download was not resumed: %v", drive.Ranges(jobState.Files[1].DriveID))
+	}
+
+	// Resume from the saved state, like "immich-importer import" does
+	resumed, err := state.Load()
+	if err != nil || resumed == nil {
+		t.Fatalf("loading saved state: %v, %v", resumed, err)
+	}
+	if resumed.ID != jobState.ID || resumed.Status != "uploading" {
+		t.Fatalf("saved state is job %s with status %q", resumed.ID, resumed.Status)
+	}
+	if resumed.UploadState.UploadedPhotos == 0 {
+		t.Fatal("no uploads recorded before the interrupt")
+	}
+
+	if err := runImport(context.Background(), cfg, resumed, googleClient, importer.Options{}); err != nil {
+		t.Fatalf("resumed runImport: %v", err)
+	}
+	checkImport(t, srv, dates)
+
+	// Every asset and the album copy are sent once; only the upload in
+	// flight at the interrupt may be repeated
+	if got, limit := srv.Uploads(), len(dates)+2; got > limit {
+		t.Errorf("got %d upload requests, want at most %d", got, limit)
+	}
+	for _, f := range resumed.Files {
+		if got := len(drive.Ranges(f.DriveID)); got > 2 {
+			t.Errorf("%s downloaded %d times", f.Name, got)
+		}
+	}
+}
+
+// taggedWith returns the number of assets with the tag of the given value
+func taggedWith(srv *immichtest.Server, value string) int {
+	n := 0
+	for _, tag := range srv.Tags() {
+		if tag.Value != value {
+			continue
+		}
+		for _, a := range srv.Assets() {
+			for _, id := range a.TagIDs {
+				if id == tag.ID {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+func TestFinishedJobIsKept(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+	options := importer.Options{JobTag: importer.DefaultJobTag}
+
+	first := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, first, googleClient, options); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+	if got := taggedWith(srv, first.Tag); got != len(dates) {
+		t.Errorf("%d asset(s) tagged %s, want %d", got, first.Tag, len(dates))
+	}
+
+	// Importing the same export again is a new job; everything is a duplicate
+	second := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, second, googleClient, options); err != nil {
+		t.Fatalf("second runImport: %v", err)
+	}
+	if second.UploadState.CreatedAssets != 0 {
+		t.Errorf("second job created %d assets", second.UploadState.CreatedAssets)
+	}
+	if got := taggedWith(srv, second.Tag); got != 0 {
+		t.Errorf("second job tagged %d asset(s) it did not create", got)
+	}
+
+	jobs, err := state.ListJobs()
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("ListJobs = %v, %v", jobs, err)
+	}
+	kept, err := state.LoadJob(first.ID)
+	if err != nil {
+		t.Fatalf("LoadJob: %v", err)
+	}
+	uploadState, err := kept.OpenUploadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kept.Close()
+	if got := len(uploadState.CreatedAssetIDs()); got != len(dates) {
+		t.Errorf("first job still knows %d created assets, want %d", got, len(dates))
+	}
+}
+
+func TestRollbackAfterAssetDeletedByHand(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+
+	jobState := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, jobState, googleClient, importer.Options{JobTag: importer.DefaultJobTag}); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+
+	// One asset is already gone when the rollback runs
+	photo, _ := srv.AssetByFilename("IMG_0001.JPG")
+	if err := srv.Client().DeleteAssets(context.Background(), []string{photo.ID}, true); err != nil {
+		t.Fatalf("deleting by hand: %v", err)
+	}
+
+	imp := importer.New(cfg.ServerURL, cfg.APIKey, importer.Options{})
+	deleted, err := imp.Rollback(context.Background(), jobState, true)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if deleted != len(dates) {
+		t.Errorf("Rollback deleted %d assets, want %d", deleted, len(dates))
+	}
+	if assets := srv.Assets(); len(assets) != 0 {
+		t.Errorf("%d asset(s) left after rollback", len(assets))
+	}
+	for _, tag := range srv.Tags() {
+		if tag.Value == jobState.Tag {
+			t.Errorf("job tag %s left after rollback", tag.Value)
+		}
+	}
+
+	// Running it again finds nothing left to do
+	if _, err := imp.Rollback(context.Background(), jobState, true); err != nil {
+		t.Fatalf("second Rollback: %v", err)
+	}
+	saved, err := state.LoadJob(jobState.ID)
+	if err != nil {
+		t.Fatalf("LoadJob: %v", err)
+	}
+	if saved.Status != "rolled-back" {
+		t.Errorf("status = %q, want rolled-back", saved.Status)
+	}
+}
+
+func TestRollbackWithAnotherUsersKey(t *testing.T) {
+	takeout, dates := testTakeout()
+	cfg, googleClient, _, srv := testEnv(t, takeout)
+
+	jobState := newJob(cfg, googleClient, true)
+	if err := runImport(context.Background(), cfg, jobState, googleClient, importer.Options{}); err != nil {
+		t.Fatalf("runImport: %v", err)
+	}
+	if jobState.UserID != "user-1" {
+		t.Fatalf("job recorded user %q", jobState.UserID)
+	}
+
+	// Immich refuses to delete the assets of another user with the same
+	// answer as for assets that are gone
+	srv.SetUser("user-2")
+	imp := importer.New(cfg.ServerURL, cfg.APIKey, importer.Options{})
+	if _, err := imp.Rollback(context.Background(), jobState, true); err == nil {
+		t.Fatal("Rollback with another user's key succeeded")
+	}
+
+	// A job from before the user was recorded cannot check the owner, so a
+	// refused delete is not taken for a deleted asset
+	jobState.UserID = ""
+	if _, err := imp.Rollback(context.Background(), jobState, true); err == nil {
+		t.Fatal("Rollback of a job without user succeeded with another user's key")
+	}
+
+	if got := len(srv.Assets()); got != len(dates) {
+		t.Errorf("%d asset(s) left, want all %d", got, len(dates))
+	}
+	saved, err := state.LoadJob(jobState.ID)
+	if err != nil {
+		t.Fatalf("LoadJob: %v", err)
+	}
+	uploadState, err := saved.OpenUploadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if saved.Status == "rolled-back" || len(uploadState.CreatedAssetIDs()) != len(dates) {
+		t.Errorf("job forgot its assets: status %s, %d created asset(s)", saved.Status, len(uploadState.CreatedAssetIDs()))
+	}
+}
+
+func TestUndatedReportKeepsEarlierRuns(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("APPDATA", home)
+
+	jobState := state.New()
+	if err := jobState.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	used := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	writeUndatedReport(jobState, &importer.Report{Undated: []importer.UndatedAsset{{Name: "a.jpg", Used: used}, {Name: "b.jpg", Used: used}}})
+	// The resumed run uploads b.jpg again and c.jpg for the first time
+	writeUndatedReport(jobState, &importer.Report{Undated: []importer.UndatedAsset{{Name: "b.jpg", Used: used}, {Name: "c.jpg", Used: used}}})
+
+	path, err := jobState.ReportPath("undated.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Assets uploaded without a known capture date, and the date used instead\n" +
+		"a.jpg\t2024-05-01T00:00:00Z\n" +
+		"b.jpg\t2024-05-01T00:00:00Z\n" +
+		"c.jpg\t2024-05-01T00:00:00Z\n"
+	if string(data) != want {
+		t.Errorf("report:\n%s\nwant:\n%s", data, want)
+	}
+
+	// The report lives and dies with the job
+	if err := state.RemoveJob(jobState.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("report of a removed job: %v, want it gone", err)
+	}
+}